@@ -38,6 +38,13 @@ func (x ModuleName) Validate() error {
 	panic("unreachable")
 }
 
+// Validate returns errors if the string is not a valid ItemName.
+// The rules are the same as for StepName and SlotName (ItemNames also
+// appear as SlotNames, when used in the exports of submodules).
+func (x ItemName) Validate() error {
+	return validateLocalName("itemName", string(x))
+}
+
 // similar to dns1123 label hunks, but allows mid-string dots also.
 const validation_moduleNamePathHunk_regexpStr string = "[a-z0-9]([-a-z0-9\\.]*[a-z0-9])?"
 const validation_moduleNamePathHunk_msg string = "must consist of lower case alphanumeric characters or '-' or '.', and must start and end with an alphanumeric character"
@@ -88,6 +95,10 @@ func validateDNS1123Subdomain(use string, value string) error {
 	return nil
 }
 
+func fmtEmptyError(use string) error {
+	return fmt.Errorf("a %s cannot be an empty string", use)
+}
+
 func fmtMaxLenError(use string, length int) error {
 	return fmt.Errorf("a %s must be no more than %d characters", use, length)
 }
@@ -6,6 +6,7 @@ import (
 	"github.com/polydawn/refmt"
 	"github.com/polydawn/refmt/cbor"
 	"github.com/polydawn/refmt/misc"
+	"github.com/polydawn/refmt/obj/atlas"
 )
 
 // FormulaSetupHash is an opaque string derived from a cryptographic hash of
@@ -24,17 +25,75 @@ type FormulaSetupHash string
 	The returned string is the base58 encoding of a SHA-384 hash, though
 	there is no reason you should treat it as anything but opaque.
 	The returned string may be relied upon to be all alphanumeric characters.
+
+	This hash doesn't say which algorithm made it; VersionedSetupHash does.
+	SetupHash remains so existing records and cache keys stay valid, and
+	FormulaSetupHash.Parse recognizes both kinds.
 */
 func (frm Formula) SetupHash() FormulaSetupHash {
+	return FormulaSetupHash(misc.Base58Encode(frm.setupDigest(sha512.New384())))
+}
+
+/*
+	CanonicalSetupHash returns the SetupHash of the canonical form of the
+	formula (see Formula.Canonicalize).  Unlike SetupHash, it converges for
+	formulae which differ only in whether they spell out default values,
+	which makes it the better key for memoizing.
+*/
+func (frm Formula) CanonicalSetupHash() FormulaSetupHash {
+	return frm.Canonicalize().SetupHash()
+}
+
+// RunRecordHash is an opaque string derived from a cryptographic hash of
+// the deterministic parts of a FormulaRunRecord.  See FormulaRunRecord.Hash.
+type RunRecordHash string
+
+// runRecordHashCode is the multihash code of "sha2-384", which FormulaRunRecord.Hash always uses.
+const runRecordHashCode = 0x20
+
+// runRecordOutcome is the part of a FormulaRunRecord covered by its Hash.
+type runRecordOutcome struct {
+	FormulaID FormulaSetupHash   `refmt:"formulaID"`
+	ExitCode  int                `refmt:"exitCode"`
+	Results   map[AbsPath]WareID `refmt:"results"`
+}
+
+var atlas_runRecordOutcome = atlas.MustBuild(
+	atlas.BuildEntry(runRecordOutcome{}).StructMap().Autogenerate().Complete(),
+	WareID_AtlasEntry,
+)
+
+/*
+	Hash returns a content-addressed identity for the outcome of a run:
+	a hash covering the FormulaID, ExitCode, and Results of the record.
+	Guid, Time, Hostname, and Metadata are excluded, since they differ
+	between runs even when the runs agree.
+
+	So, two independent runs of the same formula which produced the same
+	results have the same Hash, and counting how many builders agree on an
+	outcome is a matter of counting records by Hash.
+
+	The hash is versioned, as by Formula.VersionedSetupHash, and is always
+	made with "sha2-384" (regardless of DefaultHashAlgorithm, or of which
+	algorithms are registered), so record hashes stay stable across
+	processes and releases.  Like setup hashes, it's all alphanumeric
+	characters.
+*/
+func (rr FormulaRunRecord) Hash() RunRecordHash {
+	results := rr.Results
+	if results == nil {
+		results = map[AbsPath]WareID{} // so that nil and empty agree.
+	}
 	msg, err := refmt.MarshalAtlased(
 		cbor.EncodeOptions{},
-		frm,
-		Atlas_Formula,
+		runRecordOutcome{rr.FormulaID, rr.ExitCode, results},
+		atlas_runRecordOutcome,
 	)
 	if err != nil {
 		panic(err)
 	}
 	hasher := sha512.New384()
 	hasher.Write(msg)
-	return FormulaSetupHash(misc.Base58Encode(hasher.Sum(nil)))
+	digest := hasher.Sum(nil)
+	return RunRecordHash(misc.Base58Encode(append(multihashPrefix(runRecordHashCode, len(digest)), digest...)))
 }
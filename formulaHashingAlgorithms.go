@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"sync"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/misc"
+)
+
+/*
+	HashAlgorithm describes a hash function which can be used to compute
+	a FormulaSetupHash.
+
+	Versioned setup hashes are encoded "multihash" style: the base58 encoding
+	of a varint of the algorithm's Code, a varint of the digest length, and
+	then the digest itself.  So a versioned hash says which algorithm made it,
+	and hashes made by different algorithms can live side by side (e.g. in a
+	memo store) while migrating from one to another.
+
+	By convention, Name and Code are those given to the algorithm by the
+	multihash table (https://github.com/multiformats/multicodec).
+*/
+type HashAlgorithm struct {
+	Name string
+	Code uint64
+	New  func() hash.Hash
+}
+
+// DefaultHashAlgorithm is the name of the algorithm used by VersionedSetupHash.
+// It decides persisted IDs, so it's fixed; use SetupHashUsing to choose another.
+const DefaultHashAlgorithm = "sha2-384"
+
+// legacySetupHashLen is the length of the (decoded) hashes made by
+// Formula.SetupHash: a bare SHA-384 digest, with no multihash prefix.
+const legacySetupHashLen = sha512.Size384
+
+var hashAlgorithms = struct {
+	sync.RWMutex
+	byName map[string]HashAlgorithm
+	byCode map[uint64]HashAlgorithm
+}{
+	byName: map[string]HashAlgorithm{},
+	byCode: map[uint64]HashAlgorithm{},
+}
+
+func init() {
+	RegisterHashAlgorithm(HashAlgorithm{"sha2-256", 0x12, sha256.New})
+	RegisterHashAlgorithm(HashAlgorithm{"sha2-512", 0x13, sha512.New})
+	RegisterHashAlgorithm(HashAlgorithm{"sha2-384", 0x20, sha512.New384})
+}
+
+/*
+	RegisterHashAlgorithm makes a hash algorithm available for computing and
+	parsing versioned setup hashes.
+
+	It panics if the name or code is already registered, or if the algorithm's
+	encoded hashes would be the same length as legacy hashes (which would make
+	them ambiguous to parse).
+*/
+func RegisterHashAlgorithm(alg HashAlgorithm) {
+	hashAlgorithms.Lock()
+	defer hashAlgorithms.Unlock()
+	if _, ok := hashAlgorithms.byName[alg.Name]; ok {
+		panic(fmt.Sprintf("hash algorithm %q is already registered", alg.Name))
+	}
+	if _, ok := hashAlgorithms.byCode[alg.Code]; ok {
+		panic(fmt.Sprintf("hash algorithm code 0x%x is already registered", alg.Code))
+	}
+	if len(multihashPrefix(alg.Code, alg.New().Size()))+alg.New().Size() == legacySetupHashLen {
+		panic(fmt.Sprintf("hash algorithm %q would produce hashes indistinguishable from legacy hashes", alg.Name))
+	}
+	hashAlgorithms.byName[alg.Name] = alg
+	hashAlgorithms.byCode[alg.Code] = alg
+}
+
+// LookupHashAlgorithm returns the registered hash algorithm with the given name.
+func LookupHashAlgorithm(name string) (HashAlgorithm, bool) {
+	hashAlgorithms.RLock()
+	defer hashAlgorithms.RUnlock()
+	alg, ok := hashAlgorithms.byName[name]
+	return alg, ok
+}
+
+func multihashPrefix(code uint64, size int) []byte {
+	buf := make([]byte, binary.MaxVarintLen64*2)
+	n := binary.PutUvarint(buf, code)
+	n += binary.PutUvarint(buf[n:], uint64(size))
+	return buf[:n]
+}
+
+/*
+	VersionedSetupHash is like SetupHash, but returns a versioned hash,
+	using DefaultHashAlgorithm.  See HashAlgorithm for the encoding.
+
+	Like SetupHash, the result is all alphanumeric characters.
+*/
+func (frm Formula) VersionedSetupHash() FormulaSetupHash {
+	h, err := frm.SetupHashUsing(DefaultHashAlgorithm)
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+// SetupHashUsing returns a versioned setup hash, using the named algorithm.
+// An error is returned if no such algorithm is registered.
+func (frm Formula) SetupHashUsing(algName string) (FormulaSetupHash, error) {
+	alg, ok := LookupHashAlgorithm(algName)
+	if !ok {
+		return "", fmt.Errorf("no hash algorithm named %q is registered", algName)
+	}
+	digest := frm.setupDigest(alg.New())
+	return FormulaSetupHash(misc.Base58Encode(append(multihashPrefix(alg.Code, len(digest)), digest...))), nil
+}
+
+func (frm Formula) setupDigest(hasher hash.Hash) []byte {
+	msg, err := refmt.MarshalAtlased(
+		cbor.EncodeOptions{},
+		frm,
+		Atlas_Formula,
+	)
+	if err != nil {
+		panic(err)
+	}
+	hasher.Write(msg)
+	return hasher.Sum(nil)
+}
+
+// ParsedSetupHash is the result of FormulaSetupHash.Parse.
+type ParsedSetupHash struct {
+	Algorithm string // Name of the HashAlgorithm.
+	Legacy    bool   // True if the hash was made by SetupHash (in which case, Algorithm is "sha2-384").
+	Digest    []byte
+}
+
+/*
+	Parse decodes a setup hash, determining which algorithm made it.
+
+	Both versioned hashes and legacy hashes (as made by SetupHash) are
+	understood; legacy hashes are recognized by their length.
+	An error is returned if the hash isn't valid base58, is truncated,
+	or names an algorithm which isn't registered.
+*/
+func (h FormulaSetupHash) Parse() (ParsedSetupHash, error) {
+	bs := misc.Base58Decode(string(h))
+	if len(bs) == 0 {
+		return ParsedSetupHash{}, fmt.Errorf("setup hash %q is not valid base58", h)
+	}
+	if len(bs) == legacySetupHashLen {
+		return ParsedSetupHash{Algorithm: "sha2-384", Legacy: true, Digest: bs}, nil
+	}
+	r := bytes.NewReader(bs)
+	code, err := binary.ReadUvarint(r)
+	if err != nil {
+		return ParsedSetupHash{}, fmt.Errorf("setup hash %q is truncated", h)
+	}
+	size, err := binary.ReadUvarint(r)
+	if err != nil || size != uint64(r.Len()) {
+		return ParsedSetupHash{}, fmt.Errorf("setup hash %q is truncated", h)
+	}
+	hashAlgorithms.RLock()
+	alg, ok := hashAlgorithms.byCode[code]
+	hashAlgorithms.RUnlock()
+	if !ok {
+		return ParsedSetupHash{}, fmt.Errorf("setup hash %q uses unknown hash algorithm code 0x%x", h, code)
+	}
+	return ParsedSetupHash{Algorithm: alg.Name, Digest: bs[len(bs)-int(size):]}, nil
+}
+
+/*
+	MatchesSetupHash returns true if the given setup hash is a hash of this
+	formula, using whichever algorithm (or legacy encoding) the hash was made
+	with.  This lets records keyed by old hashes still be checked after the
+	default algorithm changes.
+*/
+func (frm Formula) MatchesSetupHash(h FormulaSetupHash) (bool, error) {
+	parsed, err := h.Parse()
+	if err != nil {
+		return false, err
+	}
+	if parsed.Legacy {
+		return frm.SetupHash() == h, nil
+	}
+	h2, err := frm.SetupHashUsing(parsed.Algorithm)
+	if err != nil {
+		return false, err
+	}
+	return h2 == h, nil
+}
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/polydawn/refmt/misc"
+	. "github.com/warpfork/go-wish"
+)
+
+func TestFormulaCanonicalization(t *testing.T) {
+	sparse := Formula{
+		Inputs: map[AbsPath]WareID{"/": {"tar", "asdf"}},
+		Action: FormulaAction{Exec: []string{"/bin/true"}},
+		Outputs: map[AbsPath]FormulaOutputSpec{
+			"/out":  {PackType: "tar"},
+			"/out2": {PackType: "tar", Filter: MustParseFilesetPackFilter("uid=keep")},
+		},
+	}
+	explicit := Formula{
+		Inputs: map[AbsPath]WareID{"/": {"tar", "asdf"}},
+		Action: FormulaAction{
+			Exec:   []string{"/bin/true"},
+			Cwd:    "/task",
+			Policy: FormulaPolicy_Routine,
+		},
+		Outputs: map[AbsPath]FormulaOutputSpec{
+			"/out":  {PackType: "tar", Filter: MustParseFilesetPackFilter("uid=1000,gid=1000,mtime=@1262304000,sticky=keep,setid=keep,dev=keep")},
+			"/out2": {PackType: "tar", Filter: MustParseFilesetPackFilter("uid=keep,gid=1000,mtime=@1262304000,sticky=keep,setid=keep,dev=keep")},
+		},
+	}
+	t.Run("defaults should be filled in", func(t *testing.T) {
+		canon := sparse.Canonicalize()
+		Wish(t, canon.Action.Cwd, ShouldEqual, AbsPath("/task"))
+		Wish(t, canon.Action.Policy, ShouldEqual, FormulaPolicy_Routine)
+		Wish(t, canon.Outputs["/out"].Filter.IsComplete(), ShouldEqual, true)
+		Wish(t, canon.Outputs["/out"].Filter.String(), ShouldEqual, FilesetPackFilter_Flatten.String())
+		Wish(t, canon.Outputs["/out2"].Filter.String(), ShouldEqual, "uid=keep,gid=1000,mtime=@1262304000,sticky=keep,setid=keep,dev=keep")
+	})
+	t.Run("canonicalizing should not modify the original", func(t *testing.T) {
+		sparse.Canonicalize()
+		Wish(t, sparse.Action.Cwd, ShouldEqual, AbsPath(""))
+		Wish(t, sparse.Outputs["/out"].Filter.IsComplete(), ShouldEqual, false)
+	})
+	t.Run("canonical hashes should converge", func(t *testing.T) {
+		Wish(t, sparse.SetupHash() == explicit.SetupHash(), ShouldEqual, false)
+		Wish(t, sparse.CanonicalSetupHash(), ShouldEqual, explicit.CanonicalSetupHash())
+		Wish(t, explicit.Canonicalize().SetupHash(), ShouldEqual, explicit.CanonicalSetupHash())
+	})
+}
+
+func TestVersionedSetupHash(t *testing.T) {
+	frm := Formula{Action: FormulaAction{Exec: []string{"/bin/true"}}}
+	t.Run("legacy hashes should be unchanged", func(t *testing.T) {
+		Wish(t, frm.SetupHash(), ShouldEqual, FormulaSetupHash("7mHdPfuSpiWnACngAMcpftsSdRioGR7HeUBHRzUNKxHzbZsNfgMaDMhY7Nzwfod5B9"))
+		parsed, err := frm.SetupHash().Parse()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, parsed.Algorithm, ShouldEqual, "sha2-384")
+		Wish(t, parsed.Legacy, ShouldEqual, true)
+	})
+	t.Run("versioned hashes should say what made them", func(t *testing.T) {
+		for _, algName := range []string{"sha2-256", "sha2-384", "sha2-512"} {
+			h, err := frm.SetupHashUsing(algName)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, alphanumericRegexp.MatchString(string(h)), ShouldEqual, true)
+			parsed, err := h.Parse()
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, parsed.Algorithm, ShouldEqual, algName)
+			Wish(t, parsed.Legacy, ShouldEqual, false)
+			match, err := frm.MatchesSetupHash(h)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, match, ShouldEqual, true)
+		}
+		Wish(t, frm.VersionedSetupHash(), ShouldEqual, must(frm.SetupHashUsing("sha2-384")))
+		// The digest is the same as the legacy one; only the encoding differs.
+		parsedLegacy, _ := frm.SetupHash().Parse()
+		parsedVersioned, _ := frm.VersionedSetupHash().Parse()
+		Wish(t, parsedVersioned.Digest, ShouldEqual, parsedLegacy.Digest)
+	})
+	t.Run("other formulas should not match", func(t *testing.T) {
+		other := Formula{Action: FormulaAction{Exec: []string{"/bin/false"}}}
+		for _, h := range []FormulaSetupHash{frm.SetupHash(), frm.VersionedSetupHash()} {
+			match, err := other.MatchesSetupHash(h)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, match, ShouldEqual, false)
+		}
+	})
+	t.Run("bad hashes should be rejected", func(t *testing.T) {
+		_, err := frm.SetupHashUsing("md5")
+		Wish(t, err, ShouldEqual, fmt.Errorf(`no hash algorithm named "md5" is registered`))
+		_, err = FormulaSetupHash("0OIl").Parse()
+		Wish(t, err, ShouldEqual, fmt.Errorf(`setup hash "0OIl" is not valid base58`))
+		h := frm.VersionedSetupHash()
+		_, err = (h[:len(h)-4]).Parse()
+		Wish(t, err, ShouldEqual, fmt.Errorf("setup hash %q is truncated", h[:len(h)-4]))
+		_, err = FormulaSetupHash(misc.Base58Encode([]byte{0x7f, 0x01, 0xaa})).Parse()
+		Wish(t, err, ShouldEqual, fmt.Errorf(`setup hash "jfHb" uses unknown hash algorithm code 0x7f`))
+	})
+}
+
+var alphanumericRegexp = regexp.MustCompile("^[a-zA-Z0-9]+$")
+
+func must(h FormulaSetupHash, err error) FormulaSetupHash {
+	if err != nil {
+		panic(err)
+	}
+	return h
+}
+
+func TestRunRecordHash(t *testing.T) {
+	rr := FormulaRunRecord{
+		Guid:      "guid-1",
+		Time:      1500000000,
+		FormulaID: "fid",
+		ExitCode:  0,
+		Results:   map[AbsPath]WareID{"/out": {"tar", "abcd"}, "/out2": {"tar", "ef01"}},
+		Hostname:  "builder-a",
+	}
+	h := rr.Hash()
+	t.Run("hash should be versioned and alphanumeric", func(t *testing.T) {
+		Wish(t, regexp.MustCompile("^[a-zA-Z0-9]+$").MatchString(string(h)), ShouldEqual, true)
+		parsed, err := FormulaSetupHash(h).Parse()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, parsed.Algorithm, ShouldEqual, "sha2-384")
+	})
+	t.Run("hash should be stable", func(t *testing.T) {
+		Wish(t, h, ShouldEqual, RunRecordHash("Q1CdtRF2y9cLxMsD1dmfrEvrr2Qx5KHen54djvEuE5f746rEFkcsfCeAnsWdodQJoqNJ"))
+	})
+	t.Run("incidental fields should not affect the hash", func(t *testing.T) {
+		rr2 := rr
+		rr2.Guid = "guid-2"
+		rr2.Time = 1600000000
+		rr2.Hostname = "builder-b"
+		rr2.Metadata = map[string]string{"note": "hi"}
+		Wish(t, rr2.Hash(), ShouldEqual, h)
+	})
+	t.Run("outcome fields should affect the hash", func(t *testing.T) {
+		rr2 := rr
+		rr2.FormulaID = "fid2"
+		Wish(t, rr2.Hash() == h, ShouldEqual, false)
+		rr2 = rr
+		rr2.ExitCode = 1
+		Wish(t, rr2.Hash() == h, ShouldEqual, false)
+		rr2 = rr
+		rr2.Results = map[AbsPath]WareID{"/out": {"tar", "abcd"}}
+		Wish(t, rr2.Hash() == h, ShouldEqual, false)
+	})
+	t.Run("nil and empty results should agree", func(t *testing.T) {
+		Wish(t, FormulaRunRecord{FormulaID: "fid"}.Hash(), ShouldEqual, FormulaRunRecord{FormulaID: "fid", Results: map[AbsPath]WareID{}}.Hash())
+	})
+}
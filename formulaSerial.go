@@ -16,6 +16,11 @@ var (
 		FormulaRunRecord_AtlasEntry,
 		WareID_AtlasEntry,
 	)
+
+	Atlas_RunRecordEnvelope = atlas.MustBuild(
+		RunRecordEnvelope_AtlasEntry,
+		RunRecordSignature_AtlasEntry,
+	)
 )
 
 var (
@@ -25,3 +30,8 @@ var (
 	FormulaOutputSpec_AtlasEntry = atlas.BuildEntry(FormulaOutputSpec{}).StructMap().Autogenerate().Complete()
 	FormulaRunRecord_AtlasEntry  = atlas.BuildEntry(FormulaRunRecord{}).StructMap().Autogenerate().Complete()
 )
+
+var (
+	RunRecordEnvelope_AtlasEntry  = atlas.BuildEntry(RunRecordEnvelope{}).StructMap().Autogenerate().Complete()
+	RunRecordSignature_AtlasEntry = atlas.BuildEntry(RunRecordSignature{}).StructMap().Autogenerate().Complete()
+)
@@ -0,0 +1,138 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/cbor"
+	"github.com/polydawn/refmt/misc"
+)
+
+/*
+	RunRecordEnvelope holds signatures over a FormulaRunRecord.
+
+	The envelope is stored alongside the record it signs (it doesn't contain
+	the record), and may hold signatures by any number of signers: for example,
+	several independent builders which each ran the formula and got the same
+	results, or a builder and a release manager which countersigned.
+
+	Signatures are Ed25519, over the canonical CBOR encoding of the whole record
+	(see RunRecordSigningPayload).
+*/
+type RunRecordEnvelope struct {
+	Signatures []RunRecordSignature `refmt:"signatures"`
+}
+
+type RunRecordSignature struct {
+	KeyID     string `refmt:"keyID"` // identifies the signing key; see RunRecordKeyID.
+	Signature string `refmt:"sig"`   // base58 encoding of the Ed25519 signature.
+}
+
+// runRecordSigningDomain prefixes the bytes that are signed, so that a
+// signature over a run record can't be mistaken for a signature over anything
+// else which happens to have the same encoding.
+const runRecordSigningDomain = "timeless.FormulaRunRecord.v1\x00"
+
+const keyIDPrefix_ed25519 = "ed25519:"
+
+// RunRecordKeyID returns the KeyID for a public key: the string "ed25519:"
+// followed by the base58 encoding of the key.
+func RunRecordKeyID(pub ed25519.PublicKey) string {
+	return keyIDPrefix_ed25519 + misc.Base58Encode(pub)
+}
+
+/*
+	RunRecordSigningPayload returns the bytes which are signed for a record:
+	a fixed domain separation string, then the canonical CBOR encoding of
+	the record (via Atlas_FormulaRunRecord; maps are encoded with sorted keys,
+	so the encoding is deterministic).
+
+	Every field of the record is covered, including Guid, Time, Hostname
+	and Metadata.
+*/
+func RunRecordSigningPayload(rr FormulaRunRecord) []byte {
+	msg, err := refmt.MarshalAtlased(
+		cbor.EncodeOptions{},
+		rr,
+		Atlas_FormulaRunRecord,
+	)
+	if err != nil {
+		panic(err)
+	}
+	return append([]byte(runRecordSigningDomain), msg...)
+}
+
+// SignRunRecord signs the record with the given key.
+func SignRunRecord(rr FormulaRunRecord, key ed25519.PrivateKey) RunRecordSignature {
+	return RunRecordSignature{
+		KeyID:     RunRecordKeyID(key.Public().(ed25519.PublicKey)),
+		Signature: misc.Base58Encode(ed25519.Sign(key, RunRecordSigningPayload(rr))),
+	}
+}
+
+// Sign adds a signature over the record by the given key to the envelope,
+// replacing any previous signature by the same key.
+func (env *RunRecordEnvelope) Sign(rr FormulaRunRecord, key ed25519.PrivateKey) {
+	sig := SignRunRecord(rr, key)
+	for i := range env.Signatures {
+		if env.Signatures[i].KeyID == sig.KeyID {
+			env.Signatures[i] = sig
+			return
+		}
+	}
+	env.Signatures = append(env.Signatures, sig)
+}
+
+/*
+	Verify checks the envelope's signatures over the record, and returns the
+	KeyIDs of the trusted keys which signed it (sorted).
+
+	Signatures by keys which aren't trusted are ignored.  An error is returned
+	if no trusted key signed the record, or if any signature which claims to
+	be by a trusted key doesn't verify (which means either the record or the
+	envelope has been tampered with, or they don't belong together).
+*/
+func (env RunRecordEnvelope) Verify(rr FormulaRunRecord, trusted []ed25519.PublicKey) ([]string, error) {
+	trustedByID := make(map[string]ed25519.PublicKey, len(trusted))
+	for _, pub := range trusted {
+		trustedByID[RunRecordKeyID(pub)] = pub
+	}
+	payload := RunRecordSigningPayload(rr)
+	verified := map[string]struct{}{}
+	for _, sig := range env.Signatures {
+		pub, ok := trustedByID[sig.KeyID]
+		if !ok {
+			continue
+		}
+		sigBytes := misc.Base58Decode(sig.Signature)
+		if len(sigBytes) != ed25519.SignatureSize || !ed25519.Verify(pub, payload, sigBytes) {
+			return nil, fmt.Errorf("signature by %s does not verify for run record %q", sig.KeyID, rr.Guid)
+		}
+		verified[sig.KeyID] = struct{}{}
+	}
+	if len(verified) == 0 {
+		return nil, fmt.Errorf("run record %q is not signed by any trusted key", rr.Guid)
+	}
+	keyIDs := make([]string, 0, len(verified))
+	for keyID := range verified {
+		keyIDs = append(keyIDs, keyID)
+	}
+	sort.Strings(keyIDs)
+	return keyIDs, nil
+}
+
+// ParseRunRecordKeyID returns the public key named by a KeyID.
+// This is handy for configuring the set of trusted keys as strings.
+func ParseRunRecordKeyID(keyID string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(keyID, keyIDPrefix_ed25519) {
+		return nil, fmt.Errorf("key ID %q is not an ed25519 key", keyID)
+	}
+	pub := misc.Base58Decode(strings.TrimPrefix(keyID, keyIDPrefix_ed25519))
+	if len(pub) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("key ID %q is malformed", keyID)
+	}
+	return ed25519.PublicKey(pub), nil
+}
@@ -0,0 +1,77 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"fmt"
+	"testing"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	. "github.com/warpfork/go-wish"
+)
+
+func TestRunRecordSigning(t *testing.T) {
+	keyA := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	keyB := ed25519.NewKeyFromSeed([]byte("0123456789abcdef0123456789abcdef"))
+	keyC := ed25519.NewKeyFromSeed([]byte("not trusted by anyone, at all..."))
+	pubA, pubB := keyA.Public().(ed25519.PublicKey), keyB.Public().(ed25519.PublicKey)
+	rr := FormulaRunRecord{
+		Guid:      "guid-1",
+		Time:      1500000000,
+		FormulaID: "fid",
+		ExitCode:  0,
+		Results:   map[AbsPath]WareID{"/out": {"tar", "abcd"}, "/out2": {"tar", "ef01"}},
+		Hostname:  "builder-a",
+	}
+
+	t.Run("multiple signers should verify", func(t *testing.T) {
+		var env RunRecordEnvelope
+		env.Sign(rr, keyA)
+		env.Sign(rr, keyB)
+		env.Sign(rr, keyC)
+		env.Sign(rr, keyA)
+		Wish(t, len(env.Signatures), ShouldEqual, 3)
+		keyIDs, err := env.Verify(rr, []ed25519.PublicKey{pubA, pubB})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, keyIDs, ShouldEqual, []string{RunRecordKeyID(pubB), RunRecordKeyID(pubA)}) // sorted.
+		keyIDs, err = env.Verify(rr, []ed25519.PublicKey{pubB})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, keyIDs, ShouldEqual, []string{RunRecordKeyID(pubB)})
+	})
+	t.Run("tampered results should not verify", func(t *testing.T) {
+		var env RunRecordEnvelope
+		env.Sign(rr, keyA)
+		rr2 := rr
+		rr2.Results = map[AbsPath]WareID{"/out": {"tar", "abcd"}, "/out2": {"tar", "bad0"}}
+		_, err := env.Verify(rr2, []ed25519.PublicKey{pubA})
+		Wish(t, err, ShouldEqual, fmt.Errorf(`signature by %s does not verify for run record "guid-1"`, RunRecordKeyID(pubA)))
+	})
+	t.Run("untrusted signers only should not verify", func(t *testing.T) {
+		var env RunRecordEnvelope
+		env.Sign(rr, keyC)
+		_, err := env.Verify(rr, []ed25519.PublicKey{pubA, pubB})
+		Wish(t, err, ShouldEqual, fmt.Errorf(`run record "guid-1" is not signed by any trusted key`))
+	})
+	t.Run("envelope should roundtrip", func(t *testing.T) {
+		var env RunRecordEnvelope
+		env.Sign(rr, keyA)
+		env.Sign(rr, keyB)
+		bs, err := refmt.MarshalAtlased(json.EncodeOptions{}, env, Atlas_RunRecordEnvelope)
+		Wish(t, err, ShouldEqual, nil)
+		var env2 RunRecordEnvelope
+		err = refmt.UnmarshalAtlased(json.DecodeOptions{}, bs, &env2, Atlas_RunRecordEnvelope)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, env2, ShouldEqual, env)
+		_, err = env2.Verify(rr, []ed25519.PublicKey{pubA, pubB})
+		Wish(t, err, ShouldEqual, nil)
+	})
+	t.Run("key IDs should parse", func(t *testing.T) {
+		pub, err := ParseRunRecordKeyID(RunRecordKeyID(pubA))
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, pub, ShouldEqual, pubA)
+		_, err = ParseRunRecordKeyID("rsa:abcd")
+		Wish(t, err, ShouldEqual, fmt.Errorf(`key ID "rsa:abcd" is not an ed25519 key`))
+		_, err = ParseRunRecordKeyID("ed25519:abcd")
+		Wish(t, err, ShouldEqual, fmt.Errorf(`key ID "ed25519:abcd" is malformed`))
+	})
+}
@@ -8,3 +8,37 @@ func (f Formula) Clone() (f2 Formula) {
 	refmt.MustCloneAtlased(f, &f2, Atlas_Formula)
 	return
 }
+
+// DefaultCwd is the working directory used for a FormulaAction which
+// doesn't specify one.
+const DefaultCwd AbsPath = "/task"
+
+/*
+	Canonicalize returns a copy of the formula with all documented defaults
+	filled in, so that formulas which describe the same setup -- one spelling
+	the defaults out, another leaving them blank -- become identical.
+
+	The defaults applied are:
+
+	  - Action.Cwd defaults to DefaultCwd ("/task");
+	  - Action.Policy defaults to FormulaPolicy_Routine;
+	  - each output's Filter is completed against FilesetPackFilter_Flatten
+	    (any filter properties left unspecified take the flatten values,
+	    and an unset filter becomes FilesetPackFilter_Flatten entirely).
+
+	The formula itself is not modified.
+*/
+func (f Formula) Canonicalize() Formula {
+	f2 := f.Clone()
+	if f2.Action.Cwd == "" {
+		f2.Action.Cwd = DefaultCwd
+	}
+	if f2.Action.Policy == "" {
+		f2.Action.Policy = FormulaPolicy_Routine
+	}
+	for path, spec := range f2.Outputs {
+		spec.Filter = spec.Filter.Apply(FilesetPackFilter_Flatten)
+		f2.Outputs[path] = spec
+	}
+	return f2
+}
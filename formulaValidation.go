@@ -0,0 +1,181 @@
+package api
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+var envNameRegexp = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// isOutputPackType returns true for the PackTypes which may be used for
+// the outputs of a Formula.
+func isOutputPackType(pt PackType) bool {
+	switch pt {
+	case "tar":
+		return true
+	default:
+		return false
+	}
+}
+
+/*
+	Validate checks a Formula for problems which would otherwise only be
+	discovered by an executor after it has already spent time unpacking inputs.
+	It returns a ValidationErrors listing every problem found, or nil.
+
+	The checks are:
+
+	  - input and output paths must be absolute and clean (see AbsPath.Validate);
+	  - no two input paths may refer to the same path once cleaned
+	    (nor may two output paths);
+	  - no input may be inside an output path (it would be packed into
+	    the output), and no output may be inside another output;
+	  - every input must have a WareID;
+	  - every output must have a PackType which can be packed (currently, only "tar");
+	  - the action must be valid (see FormulaAction.Validate).
+
+	Inputs inside other inputs (e.g. "/" and "/src") are how most formulas
+	compose a rootfs and a source tree, so they're allowed; whether they
+	assemble depends on the contents of the wares (a file seated where
+	another ware needs a directory), which only the executor can see.
+
+	The list is sorted, so the result is deterministic.
+*/
+func (frm Formula) Validate() error {
+	var errs ValidationErrors
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	// Inputs.
+	inputPaths := make([]AbsPath, 0, len(frm.Inputs))
+	for p := range frm.Inputs {
+		inputPaths = append(inputPaths, p)
+	}
+	SortMountOrder(inputPaths)
+	cleanPaths := make(map[AbsPath]AbsPath, len(inputPaths))
+	for _, p := range inputPaths {
+		if err := p.Validate(); err != nil {
+			report("input %q: %s", p, err)
+		}
+		if wareID := frm.Inputs[p]; wareID.Type == "" || wareID.Hash == "" {
+			report("input %q: ware ID %q is incomplete", p, wareID)
+		}
+		clean := p.Clean()
+		if other, ok := cleanPaths[clean]; ok {
+			report("inputs %q and %q collide", other, p)
+			continue
+		}
+		cleanPaths[clean] = p
+	}
+
+	// Outputs.
+	outputPaths := make([]AbsPath, 0, len(frm.Outputs))
+	for p := range frm.Outputs {
+		outputPaths = append(outputPaths, p)
+	}
+	SortMountOrder(outputPaths)
+	cleanPaths = make(map[AbsPath]AbsPath, len(outputPaths))
+	for _, p := range outputPaths {
+		if err := p.Validate(); err != nil {
+			report("output %q: %s", p, err)
+		}
+		if packType := frm.Outputs[p].PackType; packType == "" {
+			report("output %q: a packtype is required", p)
+		} else if !isOutputPackType(packType) {
+			report("output %q: unknown packtype %q", p, packType)
+		}
+		clean := p.Clean()
+		if other, ok := cleanPaths[clean]; ok {
+			report("outputs %q and %q collide", other, p)
+			continue
+		}
+		cleanPaths[clean] = p
+	}
+
+	// Nesting.
+	//  Only paths which are valid are checked; the rest are reported above.
+	for _, out := range outputPaths {
+		if out.Validate() != nil {
+			continue
+		}
+		for _, in := range inputPaths {
+			if in.Validate() == nil && out.IsAncestorOf(in) {
+				report("input %q is inside output %q", in, out)
+			}
+		}
+		for _, out2 := range outputPaths {
+			if out2.Validate() == nil && out.IsAncestorOf(out2) {
+				report("output %q is inside output %q", out2, out)
+			}
+		}
+	}
+
+	// Action.
+	if err := frm.Action.Validate(); err != nil {
+		for _, err := range err.(ValidationErrors) {
+			report("action: %s", err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+/*
+	Validate checks a FormulaAction for problems, and returns a
+	ValidationErrors listing every problem found, or nil.
+
+	The checks are:
+
+	  - exactly one of Exec or Noop must be set;
+	  - Policy must be unset or one of the FormulaPolicy constants;
+	  - Cwd and Userinfo.Homedir, if set, must be absolute and clean;
+	  - environment variable names must be valid POSIX names
+	    (letters, digits, and '_', not starting with a digit).
+
+	The list is sorted, so the result is deterministic.
+*/
+func (action FormulaAction) Validate() error {
+	var errs ValidationErrors
+	report := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	switch {
+	case len(action.Exec) > 0 && action.Noop:
+		report("exec and noop are mutually exclusive")
+	case len(action.Exec) == 0 && !action.Noop:
+		report("one of exec or noop is required")
+	}
+	switch action.Policy {
+	case "", FormulaPolicy_Routine, FormulaPolicy_Governor, FormulaPolicy_Sysad:
+	default:
+		report("unknown policy %q", action.Policy)
+	}
+	if action.Cwd != "" {
+		if err := action.Cwd.Validate(); err != nil {
+			report("cwd: %s", err)
+		}
+	}
+	if action.Userinfo != nil && action.Userinfo.Homedir != "" {
+		if err := action.Userinfo.Homedir.Validate(); err != nil {
+			report("homedir: %s", err)
+		}
+	}
+	for name := range action.Env {
+		if !envNameRegexp.MatchString(name) {
+			report("env %q: variable names must consist of alphanumeric characters or '_', and must not start with a digit", name)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
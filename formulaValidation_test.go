@@ -0,0 +1,107 @@
+package api
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+)
+
+func TestFormulaValidation(t *testing.T) {
+	t.Run("valid formula should pass", func(t *testing.T) {
+		frm := Formula{
+			Inputs: map[AbsPath]WareID{
+				"/":    {"tar", "abcd"},
+				"/src": {"git", "f00f"},
+			},
+			Action: FormulaAction{
+				Exec:     []string{"/bin/bash", "-c", "make"},
+				Policy:   FormulaPolicy_Governor,
+				Cwd:      "/src",
+				Env:      map[string]string{"PATH": "/bin", "_X1": "y"},
+				Userinfo: &FormulaUserinfo{Homedir: "/home/luser"},
+			},
+			Outputs: map[AbsPath]FormulaOutputSpec{
+				"/out": {PackType: "tar"},
+			},
+		}
+		Wish(t, frm.Validate(), ShouldEqual, nil)
+	})
+	t.Run("noop formula should pass", func(t *testing.T) {
+		frm := Formula{
+			Inputs:  map[AbsPath]WareID{"/a": {"tar", "abcd"}},
+			Action:  FormulaAction{Noop: true},
+			Outputs: map[AbsPath]FormulaOutputSpec{"/a": {PackType: "tar"}},
+		}
+		Wish(t, frm.Validate(), ShouldEqual, nil)
+	})
+	t.Run("all problems should be reported", func(t *testing.T) {
+		frm := Formula{
+			Inputs: map[AbsPath]WareID{
+				"/a":      {"tar", "abcd"},
+				"/a/":     {"tar", "abcd"},
+				"rel":     {"tar", "abcd"},
+				"/b/../c": {"tar", "abcd"},
+				"/d":      {},
+			},
+			Action: FormulaAction{
+				Exec:     []string{"/bin/true"},
+				Noop:     true,
+				Policy:   "superuser",
+				Cwd:      "task",
+				Env:      map[string]string{"OK": "", "1BAD": "", "NO-DASH": ""},
+				Userinfo: &FormulaUserinfo{Homedir: "/home/"},
+			},
+			Outputs: map[AbsPath]FormulaOutputSpec{
+				"/out":  {PackType: "zip"},
+				"/out2": {},
+			},
+		}
+		err := frm.Validate()
+		var msgs []string
+		for _, err := range err.(ValidationErrors) {
+			msgs = append(msgs, err.Error())
+		}
+		Wish(t, msgs, ShouldEqual, []string{
+			`action: cwd: path must be absolute`,
+			`action: env "1BAD": variable names must consist of alphanumeric characters or '_', and must not start with a digit`,
+			`action: env "NO-DASH": variable names must consist of alphanumeric characters or '_', and must not start with a digit`,
+			`action: exec and noop are mutually exclusive`,
+			`action: homedir: path is not clean (should be "/home")`,
+			`action: unknown policy "superuser"`,
+			`input "/a/": path is not clean (should be "/a")`,
+			`input "/b/../c": path is not clean (should be "/c")`,
+			`input "/d": ware ID "" is incomplete`,
+			`input "rel": path must be absolute`,
+			`inputs "/a" and "/a/" collide`,
+			`output "/out": unknown packtype "zip"`,
+			`output "/out2": a packtype is required`,
+		})
+	})
+	t.Run("mounts inside outputs should be rejected", func(t *testing.T) {
+		frm := Formula{
+			Inputs: map[AbsPath]WareID{
+				"/":         {"tar", "abcd"},
+				"/src":      {"git", "f00f"},
+				"/out/seed": {"tar", "abcd"},
+			},
+			Action: FormulaAction{Exec: []string{"/bin/true"}},
+			Outputs: map[AbsPath]FormulaOutputSpec{
+				"/src":     {PackType: "tar"},
+				"/out":     {PackType: "tar"},
+				"/out/bin": {PackType: "tar"},
+			},
+		}
+		err := frm.Validate()
+		var msgs []string
+		for _, err := range err.(ValidationErrors) {
+			msgs = append(msgs, err.Error())
+		}
+		Wish(t, msgs, ShouldEqual, []string{
+			`input "/out/seed" is inside output "/out"`,
+			`output "/out/bin" is inside output "/out"`,
+		})
+	})
+	t.Run("action needs exec or noop", func(t *testing.T) {
+		Wish(t, FormulaAction{}.Validate().Error(), ShouldEqual, "one of exec or noop is required")
+	})
+}
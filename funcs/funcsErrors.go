@@ -0,0 +1,93 @@
+package funcs
+
+import (
+	"fmt"
+	"strings"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+type ErrorCategory string
+
+const (
+	ErrInvalidReference ErrorCategory = ("funcs-invalid-reference") // Indicates a SlotRef (or SubmoduleRef) doesn't point at anything that exists in the module.
+	ErrMissingImport    ErrorCategory = ("funcs-missing-import")    // Indicates a SlotRef refers to an import which doesn't exist.  A more specific form of ErrInvalidReference.
+	ErrMissingStep      ErrorCategory = ("funcs-missing-step")      // Indicates a SlotRef refers to a step which doesn't exist.  A more specific form of ErrInvalidReference.
+	ErrMissingOutput    ErrorCategory = ("funcs-missing-output")    // Indicates a SlotRef refers to a step which exists, but has no such output (or export, for submodules).  A more specific form of ErrInvalidReference.
+	ErrInvalidImport    ErrorCategory = ("funcs-invalid-import")    // Indicates an import of a kind that's not allowed where it's used (e.g. ingest imports in submodules).
+	ErrModuleCycle      ErrorCategory = ("funcs-module-cycle")      // Indicates the steps of a module depend on each other in a loop (they don't form a DAG).
+	ErrUnresolvedSlot   ErrorCategory = ("funcs-unresolved-slot")   // Indicates a SlotRef is valid, but there's no WareID known for it yet (no pin, or the step producing it hasn't run).
+	ErrStepFailed       ErrorCategory = ("funcs-step-failed")       // Indicates an Operation was run, but did not succeed (it exited nonzero, or failed to produce one of its outputs).
+	ErrInvalidLockfile  ErrorCategory = ("funcs-invalid-lockfile")  // Indicates a Lockfile doesn't parse, or has a malformed pin key.  (The lockfile is corrupt; resolving again and rewriting it would hide that.)
+	ErrStaleLockfile    ErrorCategory = ("funcs-stale-lockfile")    // Indicates a Lockfile is valid, but doesn't have pins for every import in the module.
+)
+
+// CycleError is returned (as an errcat.Error of category ErrModuleCycle)
+// when the steps of a module don't form a DAG.
+type CycleError struct {
+	// The steps in the loop, each depending on the next.
+	// The first step is repeated at the end.
+	Cycle []api.SubmoduleStepRef
+}
+
+func (e CycleError) Category() interface{} { return ErrModuleCycle }
+func (e CycleError) Message() string {
+	return fmt.Sprintf("not a dag: loop detected: %s", e.cycleString(" -> "))
+}
+func (e CycleError) Details() map[string]string {
+	return map[string]string{
+		"step":  e.Cycle[0].String(),
+		"cycle": e.cycleString(","),
+	}
+}
+func (e CycleError) Error() string { return e.Message() }
+
+func (e CycleError) cycleString(sep string) string {
+	ss := make([]string, len(e.Cycle))
+	for i, stepRef := range e.Cycle {
+		ss[i] = stepRef.String()
+	}
+	return strings.Join(ss, sep)
+}
+
+// ReferenceError is returned (as an errcat.Error, with one of the categories
+// ErrMissingImport, ErrMissingStep, ErrMissingOutput, or ErrInvalidImport)
+// when a step in a module has an input or import which is invalid.
+type ReferenceError struct {
+	Category_ ErrorCategory
+	Step      api.SubmoduleStepRef // The step with the invalid reference.
+	Slot      api.SlotRef          // The invalid reference (for submodules, the reference in the parent import; or, for ErrInvalidImport, the name of the import).
+	Reason    string               // Freetext explanation.
+}
+
+func (e ReferenceError) Category() interface{} { return e.Category_ }
+func (e ReferenceError) Message() string {
+	return fmt.Sprintf("step %q has an invalid reference to %q: %s", e.Step, e.Slot, e.Reason)
+}
+func (e ReferenceError) Details() map[string]string {
+	return map[string]string{
+		"step":   e.Step.String(),
+		"slot":   e.Slot.String(),
+		"reason": e.Reason,
+	}
+}
+func (e ReferenceError) Error() string { return e.Message() }
+
+// contextualizeError prefixes the step references in a CycleError or
+// ReferenceError with the given submodule name.  Other errors pass through.
+// (This is used to lift errors found while recursing into submodules.)
+func contextualizeError(err error, submoduleName api.StepName) error {
+	switch e2 := err.(type) {
+	case CycleError:
+		cycle := make([]api.SubmoduleStepRef, len(e2.Cycle))
+		for i, stepRef := range e2.Cycle {
+			cycle[i] = stepRef.Contextualize(api.SubmoduleRef(submoduleName))
+		}
+		return CycleError{cycle}
+	case ReferenceError:
+		e2.Step = e2.Step.Contextualize(api.SubmoduleRef(submoduleName))
+		return e2
+	default:
+		return err
+	}
+}
@@ -0,0 +1,231 @@
+package funcs
+
+import (
+	"fmt"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+// DefaultPackType is the PackType used for the outputs of a Formula bound
+// from an Operation.  (Operations don't specify pack types; Formulas must.)
+const DefaultPackType api.PackType = "tar"
+
+/*
+	BindOperation looks up the Operation at `stepRef` in the module and binds
+	it into a Formula: each input SlotRef is resolved to a concrete WareID,
+	and each output slot is mapped to a FormulaOutputSpec.
+
+	Inputs are resolved by ResolveSlotRef: references to imports are looked up
+	in `pins` (following "parent:" imports up through submodules as necessary),
+	and references to the outputs of other steps are looked up in `records`
+	(following submodule exports down as necessary).
+
+	Errors will be of category ErrInvalidReference if the module wiring
+	is broken, or ErrUnresolvedSlot if the wiring is fine but some pin or
+	record needed to resolve an input is not yet available.
+
+	A pointer is returned to express maybe-ness.
+*/
+func BindOperation(
+	m api.Module,
+	stepRef api.SubmoduleStepRef,
+	pins Pins,
+	records map[api.SubmoduleStepRef]api.OperationRecord,
+) (*api.Formula, error) {
+	op, err := operationAt(m, stepRef)
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve inputs.  Go in mount order, so errors are deterministic.
+	paths := make([]api.AbsPath, 0, len(op.Inputs))
+	for path := range op.Inputs {
+		paths = append(paths, path)
+	}
+	api.SortMountOrder(paths)
+	frm := api.Formula{
+		Inputs:  make(map[api.AbsPath]api.WareID, len(op.Inputs)),
+		Action:  op.Action,
+		Outputs: make(map[api.AbsPath]api.FormulaOutputSpec, len(op.Outputs)),
+	}
+	for _, path := range paths {
+		slotRef := op.Inputs[path]
+		wareID, err := ResolveSlotRef(m, api.SubmoduleSlotRef{SubmoduleRef: stepRef.SubmoduleRef, SlotRef: slotRef}, pins, records)
+		if err != nil {
+			return nil, errcat.AppendDetail(err, "step", stepRef.String())
+		}
+		frm.Inputs[path] = wareID
+	}
+
+	// Map outputs.
+	for _, path := range op.Outputs {
+		frm.Outputs[path] = api.FormulaOutputSpec{PackType: DefaultPackType}
+	}
+	return &frm, nil
+}
+
+/*
+	ResolveSlotRef returns the WareID a slot reference refers to, given the
+	pinned imports of a module and the records of steps that have already run.
+
+	The slot reference is first traced to its source (see traceSlotRef), so
+	references to submodule exports and "parent:" imports work transparently.
+
+	Errors will be of category ErrInvalidReference or ErrUnresolvedSlot.
+*/
+func ResolveSlotRef(
+	m api.Module,
+	ref api.SubmoduleSlotRef,
+	pins Pins,
+	records map[api.SubmoduleStepRef]api.OperationRecord,
+) (api.WareID, error) {
+	src, err := traceSlotRef(m, ref)
+	if err != nil {
+		return api.WareID{}, err
+	}
+	if src.StepName == "" {
+		wareID, ok := pins[src]
+		if !ok {
+			return api.WareID{}, errcat.ErrorDetailed(ErrUnresolvedSlot,
+				fmt.Sprintf("%q refers to import %q, which has no pin", ref, src),
+				map[string]string{
+					"ref":    ref.String(),
+					"source": src.String(),
+				},
+			)
+		}
+		return wareID, nil
+	}
+	srcStep := api.SubmoduleStepRef{SubmoduleRef: src.SubmoduleRef, StepName: src.StepName}
+	record, ok := records[srcStep]
+	if !ok {
+		return api.WareID{}, errcat.ErrorDetailed(ErrUnresolvedSlot,
+			fmt.Sprintf("%q refers to an output of step %q, which has no record", ref, srcStep),
+			map[string]string{
+				"ref":    ref.String(),
+				"source": src.String(),
+			},
+		)
+	}
+	wareID, ok := record.Results[src.SlotName]
+	if !ok {
+		return api.WareID{}, errcat.ErrorDetailed(ErrUnresolvedSlot,
+			fmt.Sprintf("%q refers to output %q of step %q, which is missing from the step's record", ref, src.SlotName, srcStep),
+			map[string]string{
+				"ref":    ref.String(),
+				"source": src.String(),
+			},
+		)
+	}
+	return wareID, nil
+}
+
+/*
+	traceSlotRef follows a slot reference to its source: either an output
+	of an Operation, or an import which is not a "parent:" import (and thus
+	is resolved by pinning).
+
+	"parent:" imports are followed up into the enclosing module;
+	references to the exports of submodules are followed down into the
+	submodule.  The returned ref will thus either have a StepName that
+	refers to an Operation, or a zero StepName and a SlotName referring to
+	a catalog or ingest import.
+
+	Errors will be of category ErrInvalidReference.
+*/
+func traceSlotRef(m api.Module, ref api.SubmoduleSlotRef) (api.SubmoduleSlotRef, error) {
+	orig := ref
+	seen := map[api.SubmoduleSlotRef]struct{}{}
+	for {
+		if _, ok := seen[ref]; ok {
+			return ref, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("%q cannot be resolved: references loop at %q", orig, ref),
+				map[string]string{"ref": orig.String()},
+			)
+		}
+		seen[ref] = struct{}{}
+		mod, err := moduleAt(m, ref.SubmoduleRef)
+		if err != nil {
+			return ref, err
+		}
+		if ref.StepName == "" {
+			imp, ok := mod.Imports[ref.SlotName]
+			if !ok {
+				return ref, errcat.ErrorDetailed(ErrInvalidReference,
+					fmt.Sprintf("%q cannot be resolved: %q is not the name of an import in module %q", orig, ref.SlotName, ref.SubmoduleRef),
+					map[string]string{"ref": orig.String()},
+				)
+			}
+			parentRef, ok := imp.(api.ImportRef_Parent)
+			if !ok {
+				return ref, nil
+			}
+			if ref.SubmoduleRef == "" {
+				return ref, errcat.ErrorDetailed(ErrInvalidReference,
+					fmt.Sprintf("%q cannot be resolved: the root module can't have parent imports", orig),
+					map[string]string{"ref": orig.String()},
+				)
+			}
+			ref = api.SubmoduleSlotRef{SubmoduleRef: ref.SubmoduleRef.Parent(), SlotRef: api.SlotRef(parentRef)}
+			continue
+		}
+		switch step := mod.Steps[ref.StepName].(type) {
+		case api.Operation:
+			if _, ok := step.Outputs[ref.SlotName]; !ok {
+				return ref, errcat.ErrorDetailed(ErrInvalidReference,
+					fmt.Sprintf("%q cannot be resolved: step %q has no output named %q", orig, api.SubmoduleStepRef{SubmoduleRef: ref.SubmoduleRef, StepName: ref.StepName}, ref.SlotName),
+					map[string]string{"ref": orig.String()},
+				)
+			}
+			return ref, nil
+		case api.Module:
+			export, ok := step.Exports[api.ItemName(ref.SlotName)]
+			if !ok {
+				return ref, errcat.ErrorDetailed(ErrInvalidReference,
+					fmt.Sprintf("%q cannot be resolved: submodule %q has no export named %q", orig, api.SubmoduleStepRef{SubmoduleRef: ref.SubmoduleRef, StepName: ref.StepName}, ref.SlotName),
+					map[string]string{"ref": orig.String()},
+				)
+			}
+			ref = api.SubmoduleSlotRef{SubmoduleRef: ref.SubmoduleRef.Child(ref.StepName), SlotRef: export}
+		default:
+			return ref, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("%q cannot be resolved: %q is not the name of a step in module %q", orig, ref.StepName, ref.SubmoduleRef),
+				map[string]string{"ref": orig.String()},
+			)
+		}
+	}
+}
+
+// moduleAt returns the (sub)module found by following the SubmoduleRef
+// down from the given module.  The zero SubmoduleRef returns `m` itself.
+func moduleAt(m api.Module, ref api.SubmoduleRef) (api.Module, error) {
+	for rest := ref; rest != ""; rest = rest.Decontextualize() {
+		sub, ok := m.Steps[rest.First()].(api.Module)
+		if !ok {
+			return api.Module{}, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("%q is not a submodule", ref),
+				map[string]string{"ref": string(ref)},
+			)
+		}
+		m = sub
+	}
+	return m, nil
+}
+
+// operationAt returns the Operation found at the given step reference.
+func operationAt(m api.Module, ref api.SubmoduleStepRef) (api.Operation, error) {
+	mod, err := moduleAt(m, ref.SubmoduleRef)
+	if err != nil {
+		return api.Operation{}, err
+	}
+	op, ok := mod.Steps[ref.StepName].(api.Operation)
+	if !ok {
+		return api.Operation{}, errcat.ErrorDetailed(ErrInvalidReference,
+			fmt.Sprintf("%q is not an operation", ref),
+			map[string]string{"ref": ref.String()},
+		)
+	}
+	return op, nil
+}
@@ -0,0 +1,95 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+)
+
+func TestBindOperation(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepA": Operation{
+				Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}},
+				Action:  FormulaAction{Exec: []string{"/make"}},
+				Outputs: map[SlotName]AbsPath{"intermediate": "/out"},
+			},
+			"stepB": Module{
+				Imports: map[SlotName]ImportRef{
+					"base":   ImportRef_Parent{"", "base"},
+					"wodget": ImportRef_Parent{"stepA", "intermediate"},
+				},
+				Steps: map[StepName]StepUnion{
+					"op": Operation{
+						Inputs: map[AbsPath]SlotRef{
+							"/":    {"", "base"},
+							"/src": {"", "wodget"},
+						},
+						Action:  FormulaAction{Exec: []string{"/tool"}},
+						Outputs: map[SlotName]AbsPath{"bin": "/out"},
+					},
+				},
+				Exports: map[ItemName]SlotRef{"barred": {"op", "bin"}},
+			},
+			"stepC": Operation{
+				Inputs: map[AbsPath]SlotRef{
+					"/":    {"", "base"},
+					"/bar": {"stepB", "barred"},
+				},
+				Action: FormulaAction{Exec: []string{"/bar/thinger"}},
+			},
+		},
+	}
+	pins := Pins{
+		{"", SlotRef{"", "base"}}: {"tar", "asdf"},
+	}
+	records := map[SubmoduleStepRef]OperationRecord{
+		{"", "stepA"}: {Results: map[SlotName]WareID{"intermediate": {"tar", "qwer"}}},
+	}
+
+	t.Run("bind through parent imports", func(t *testing.T) {
+		frm, err := BindOperation(module, SubmoduleStepRef{"stepB", "op"}, pins, records)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, *frm, ShouldEqual, Formula{
+			Inputs: map[AbsPath]WareID{
+				"/":    {"tar", "asdf"},
+				"/src": {"tar", "qwer"},
+			},
+			Action: FormulaAction{Exec: []string{"/tool"}},
+			Outputs: map[AbsPath]FormulaOutputSpec{
+				"/out": {PackType: "tar"},
+			},
+		})
+	})
+	t.Run("bind through submodule exports", func(t *testing.T) {
+		records := map[SubmoduleStepRef]OperationRecord{
+			{"", "stepA"}:   records[SubmoduleStepRef{"", "stepA"}],
+			{"stepB", "op"}: {Results: map[SlotName]WareID{"bin": {"tar", "zxcv"}}},
+		}
+		frm, err := BindOperation(module, SubmoduleStepRef{"", "stepC"}, pins, records)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, frm.Inputs, ShouldEqual, map[AbsPath]WareID{
+			"/":    {"tar", "asdf"},
+			"/bar": {"tar", "zxcv"},
+		})
+	})
+	t.Run("missing records are unresolved", func(t *testing.T) {
+		_, err := BindOperation(module, SubmoduleStepRef{"", "stepC"}, pins, records)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrUnresolvedSlot)
+		Wish(t, errcat.Details(err)["source"], ShouldEqual, "stepB.op.bin")
+	})
+	t.Run("missing pins are unresolved", func(t *testing.T) {
+		_, err := BindOperation(module, SubmoduleStepRef{"", "stepA"}, Pins{}, records)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrUnresolvedSlot)
+	})
+	t.Run("binding a non-operation is invalid", func(t *testing.T) {
+		_, err := BindOperation(module, SubmoduleStepRef{"", "stepB"}, pins, records)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidReference)
+	})
+}
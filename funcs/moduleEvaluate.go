@@ -0,0 +1,144 @@
+package funcs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/repeatr"
+)
+
+/*
+	EvaluateModule runs every Operation in a module (recursively including
+	all submodules), in the order given by ModuleOrderStepsDeep.
+
+	Each Operation is bound into a Formula using BindOperation -- so its
+	inputs come either from `pins` or from the records of the steps that
+	ran before it -- and then handed to `runFunc`.  Fetch addresses for the
+	inputs are chosen from `wareSourcing`; save addresses for the outputs
+	are chosen from `wareStaging`.
+
+	The WareIDs of the module's Exports are returned, along with the records
+	of every Operation that was run.  If evaluation halts with an error,
+	the records of every Operation run so far are still returned.
+
+	Errors from `runFunc` are returned as-is (with a "step" detail attached);
+	Operations which ran but exited nonzero return ErrStepFailed.
+
+	EvaluateModule is EvaluateModuleConcurrently with a single worker.
+*/
+func EvaluateModule(
+	ctx context.Context,
+	m api.Module,
+	pins Pins,
+	wareSourcing api.WareSourcing,
+	wareStaging api.WareStaging,
+	runFunc repeatr.RunFunc,
+) (map[api.ItemName]api.WareID, map[api.SubmoduleStepRef]api.OperationRecord, error) {
+	return EvaluateModuleConcurrently(ctx, m, pins, wareSourcing, wareStaging, runFunc, 1)
+}
+
+/*
+	EvaluateModuleConcurrently is like EvaluateModule, but runs up to `workers`
+	Operations at once, starting each one as soon as its inputs are available.
+	See ScheduleSteps for the details of ordering and cancellation.
+*/
+func EvaluateModuleConcurrently(
+	ctx context.Context,
+	m api.Module,
+	pins Pins,
+	wareSourcing api.WareSourcing,
+	wareStaging api.WareStaging,
+	runFunc repeatr.RunFunc,
+	workers int,
+) (map[api.ItemName]api.WareID, map[api.SubmoduleStepRef]api.OperationRecord, error) {
+	var mu sync.Mutex
+	records := make(map[api.SubmoduleStepRef]api.OperationRecord)
+	err := ScheduleSteps(ctx, m, workers, func(ctx context.Context, stepRef api.SubmoduleStepRef) error {
+		mu.Lock()
+		frm, err := BindOperation(m, stepRef, pins, records)
+		mu.Unlock()
+		if err != nil {
+			return err
+		}
+		record, err := evaluateStep(ctx, m, stepRef, *frm, wareSourcing, wareStaging, runFunc)
+		if record != nil {
+			mu.Lock()
+			records[stepRef] = *record
+			mu.Unlock()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, records, err
+	}
+	exports, err := resolveExports(m, pins, records)
+	return exports, records, err
+}
+
+// evaluateStep runs a single Operation, already bound into a Formula.
+// The record is returned even if the step failed, if there is one.
+func evaluateStep(
+	ctx context.Context,
+	m api.Module,
+	stepRef api.SubmoduleStepRef,
+	frm api.Formula,
+	wareSourcing api.WareSourcing,
+	wareStaging api.WareStaging,
+	runFunc repeatr.RunFunc,
+) (*api.OperationRecord, error) {
+	op, err := operationAt(m, stepRef)
+	if err != nil {
+		return nil, err
+	}
+	frmCtx := repeatr.FormulaContext{
+		FetchUrls: make(map[api.AbsPath][]api.WarehouseLocation, len(frm.Inputs)),
+		SaveUrls:  make(map[api.AbsPath]api.WarehouseLocation, len(frm.Outputs)),
+	}
+	for path, wareID := range frm.Inputs {
+		frmCtx.FetchUrls[path] = wareSourcing.PivotToWareID(wareID)
+	}
+	for path, spec := range frm.Outputs {
+		if loc, ok := wareStaging.ByPackType[spec.PackType]; ok {
+			frmCtx.SaveUrls[path] = loc
+		}
+	}
+	frr, err := runFunc(ctx, frm, frmCtx, repeatr.InputControl{}, repeatr.Monitor{})
+	if err != nil {
+		return nil, errcat.AppendDetail(err, "step", stepRef.String())
+	}
+	record, convErr := api.OperationRecordFromRunRecord(op, *frr)
+	if frr.ExitCode != 0 {
+		return &record, errcat.ErrorDetailed(ErrStepFailed,
+			fmt.Sprintf("step %q exited with code %d", stepRef, frr.ExitCode),
+			map[string]string{"step": stepRef.String()},
+		)
+	}
+	if convErr != nil {
+		return &record, errcat.ErrorDetailed(ErrStepFailed,
+			fmt.Sprintf("step %q did not produce its outputs: %s", stepRef, convErr),
+			map[string]string{"step": stepRef.String()},
+		)
+	}
+	return &record, nil
+}
+
+// resolveExports resolves all the exports of the module to WareIDs.
+func resolveExports(
+	m api.Module,
+	pins Pins,
+	records map[api.SubmoduleStepRef]api.OperationRecord,
+) (map[api.ItemName]api.WareID, error) {
+	exports := make(map[api.ItemName]api.WareID, len(m.Exports))
+	for itemName, slotRef := range m.Exports {
+		wareID, err := ResolveSlotRef(m, api.SubmoduleSlotRef{SlotRef: slotRef}, pins, records)
+		if err != nil {
+			return nil, errcat.AppendDetail(err, "export", string(itemName))
+		}
+		exports[itemName] = wareID
+	}
+	return exports, nil
+}
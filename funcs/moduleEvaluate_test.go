@@ -0,0 +1,142 @@
+package funcs
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/repeatr"
+)
+
+// fakeRunner is a RunFunc that "produces" wares named after the formula's
+// exec command and output path, and keeps a log of what it was asked to run.
+type fakeRunner struct {
+	mu  sync.Mutex
+	log []string
+}
+
+func (r *fakeRunner) Run(
+	ctx context.Context,
+	frm Formula,
+	frmCtx repeatr.FormulaContext,
+	_ repeatr.InputControl,
+	_ repeatr.Monitor,
+) (*FormulaRunRecord, error) {
+	cmd := strings.Join(frm.Action.Exec, " ")
+	r.mu.Lock()
+	r.log = append(r.log, cmd)
+	r.mu.Unlock()
+	rr := &FormulaRunRecord{
+		FormulaID: frm.SetupHash(),
+		Results:   map[AbsPath]WareID{},
+	}
+	if cmd == "fail" {
+		rr.ExitCode = 1
+	}
+	for path := range frm.Outputs {
+		rr.Results[path] = WareID{"tar", cmd + ":" + string(path)}
+	}
+	return rr, nil
+}
+
+func fixtureEvaluationModule() Module {
+	return Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepA": Operation{
+				Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/src": {"", "src"}},
+				Action:  FormulaAction{Exec: []string{"a"}},
+				Outputs: map[SlotName]AbsPath{"out": "/out"},
+			},
+			"stepB": Module{
+				Imports: map[SlotName]ImportRef{
+					"base": ImportRef_Parent{"", "base"},
+					"x":    ImportRef_Parent{"stepA", "out"},
+				},
+				Steps: map[StepName]StepUnion{
+					"op": Operation{
+						Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/x": {"", "x"}},
+						Action:  FormulaAction{Exec: []string{"b"}},
+						Outputs: map[SlotName]AbsPath{"out": "/out"},
+					},
+				},
+				Exports: map[ItemName]SlotRef{"bexp": {"op", "out"}},
+			},
+			"stepC": Operation{
+				Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/b": {"stepB", "bexp"}},
+				Action:  FormulaAction{Exec: []string{"c"}},
+				Outputs: map[SlotName]AbsPath{"final": "/b"},
+			},
+		},
+		Exports: map[ItemName]SlotRef{
+			"src":             {"", "src"},
+			"bin-linux-amd64": {"stepC", "final"},
+		},
+	}
+}
+
+func fixtureEvaluationPins() Pins {
+	return Pins{
+		{"", SlotRef{"", "base"}}: {"tar", "base"},
+		{"", SlotRef{"", "src"}}:  {"git", "f00f"},
+	}
+}
+
+func TestEvaluateModule(t *testing.T) {
+	t.Run("happy path", func(t *testing.T) {
+		runner := &fakeRunner{}
+		exports, records, err := EvaluateModule(context.Background(),
+			fixtureEvaluationModule(), fixtureEvaluationPins(),
+			WareSourcing{}, WareStaging{}, runner.Run,
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, runner.log, ShouldEqual, []string{"a", "b", "c"})
+		Wish(t, exports, ShouldEqual, map[ItemName]WareID{
+			"src":             {"git", "f00f"},
+			"bin-linux-amd64": {"tar", "c:/b"},
+		})
+		var steps []string
+		for stepRef := range records {
+			steps = append(steps, stepRef.String())
+		}
+		sort.Strings(steps)
+		Wish(t, steps, ShouldEqual, []string{"stepA", "stepB.op", "stepC"})
+		Wish(t, records[SubmoduleStepRef{"stepB", "op"}].Results, ShouldEqual, map[SlotName]WareID{
+			"out": {"tar", "b:/out"},
+		})
+	})
+	t.Run("concurrent evaluation agrees", func(t *testing.T) {
+		runner := &fakeRunner{}
+		exports, records, err := EvaluateModuleConcurrently(context.Background(),
+			fixtureEvaluationModule(), fixtureEvaluationPins(),
+			WareSourcing{}, WareStaging{}, runner.Run, 4,
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, exports["bin-linux-amd64"], ShouldEqual, WareID{"tar", "c:/b"})
+		Wish(t, len(records), ShouldEqual, 3)
+	})
+	t.Run("failing step halts evaluation", func(t *testing.T) {
+		mod := fixtureEvaluationModule()
+		op := mod.Steps["stepB"].(Module).Steps["op"].(Operation)
+		op.Action.Exec = []string{"fail"}
+		mod.Steps["stepB"].(Module).Steps["op"] = op
+		runner := &fakeRunner{}
+		_, records, err := EvaluateModule(context.Background(),
+			mod, fixtureEvaluationPins(),
+			WareSourcing{}, WareStaging{}, runner.Run,
+		)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrStepFailed)
+		Wish(t, errcat.Details(err)["step"], ShouldEqual, "stepB.op")
+		Wish(t, runner.log, ShouldEqual, []string{"a", "fail"})
+		Wish(t, len(records), ShouldEqual, 2)
+	})
+}
@@ -0,0 +1,352 @@
+package funcs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+/*
+	FlattenModule inlines all the submodules of a module, returning a module
+	which has only Operations for steps.
+
+	Each Operation is renamed to the string form of its SubmoduleStepRef
+	(so "op" in submodule "stepB" becomes the step "stepB.op"), and each
+	catalog or ingest import is likewise renamed to the string form of its
+	SubmoduleSlotRef ("stepB.base").  "parent:" imports and the exports of
+	submodules disappear: every input is rewired to refer directly to the
+	import or Operation output it ultimately comes from (see traceSlotRef).
+	The exports of the root module are rewired the same way.
+
+	Since the new step and slot names contain dots, the flattened module is
+	not valid by Module.Validate, and doesn't serialize unambiguously;
+	it's meant for in-memory use, e.g. by schedulers and caches which would
+	rather not think about submodules.  The flat module can be evaluated
+	as usual (pins for it are made with FlattenPins), and the results mapped
+	back to the nested form with NestRecords.
+
+	Errors are as for ModuleOrderStepsDeep, or ErrInvalidReference.
+*/
+func FlattenModule(m api.Module) (api.Module, error) {
+	all, err := ModuleOrderStepsDeep(m)
+	if err != nil {
+		return api.Module{}, err
+	}
+	flat := api.Module{
+		Imports: map[api.SlotName]api.ImportRef{},
+		Steps:   map[api.StepName]api.StepUnion{},
+		Exports: map[api.ItemName]api.SlotRef{},
+	}
+	flattenImports(m, "", flat.Imports)
+	for _, stepRef := range all {
+		op, err := operationAt(m, stepRef)
+		if err != nil {
+			continue // submodules themselves vanish.
+		}
+		inputs := make(map[api.AbsPath]api.SlotRef, len(op.Inputs))
+		for path, slotRef := range op.Inputs {
+			src, err := traceSlotRef(m, api.SubmoduleSlotRef{SubmoduleRef: stepRef.SubmoduleRef, SlotRef: slotRef})
+			if err != nil {
+				return api.Module{}, errcat.AppendDetail(err, "step", stepRef.String())
+			}
+			inputs[path] = flattenSlotRef(src)
+		}
+		op.Inputs = inputs
+		flat.Steps[FlattenStepRef(stepRef).StepName] = op
+	}
+	for itemName, slotRef := range m.Exports {
+		src, err := traceSlotRef(m, api.SubmoduleSlotRef{SlotRef: slotRef})
+		if err != nil {
+			return api.Module{}, errcat.AppendDetail(err, "export", string(itemName))
+		}
+		flat.Exports[itemName] = flattenSlotRef(src)
+	}
+	return flat, nil
+}
+
+func flattenImports(m api.Module, at api.SubmoduleRef, into map[api.SlotName]api.ImportRef) {
+	for slotName, imp := range m.Imports {
+		if _, ok := imp.(api.ImportRef_Parent); ok {
+			continue
+		}
+		into[flattenSlotRef(api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: slotName}}).SlotName] = imp
+	}
+	for stepName, step := range m.Steps {
+		if x, ok := step.(api.Module); ok {
+			flattenImports(x, at.Child(stepName), into)
+		}
+	}
+}
+
+// flattenSlotRef converts a traced ref (as returned by traceSlotRef) into
+// the SlotRef which refers to the same thing in the flattened module.
+func flattenSlotRef(src api.SubmoduleSlotRef) api.SlotRef {
+	if src.StepName == "" {
+		return api.SlotRef{SlotName: api.SlotName(src.String())}
+	}
+	return api.SlotRef{
+		StepName: FlattenStepRef(api.SubmoduleStepRef{SubmoduleRef: src.SubmoduleRef, StepName: src.StepName}).StepName,
+		SlotName: src.SlotName,
+	}
+}
+
+// FlattenStepRef returns the ref to a step in the module returned by
+// FlattenModule, given the ref to that step in the original module.
+func FlattenStepRef(ref api.SubmoduleStepRef) api.SubmoduleStepRef {
+	return api.SubmoduleStepRef{StepName: api.StepName(ref.String())}
+}
+
+// NestStepRef is the inverse of FlattenStepRef.
+func NestStepRef(ref api.SubmoduleStepRef) api.SubmoduleStepRef {
+	at, name := splitFlatName(string(ref.StepName))
+	return api.SubmoduleStepRef{SubmoduleRef: at, StepName: api.StepName(name)}
+}
+
+// FlattenPins converts pins for a module (as returned by ResolvePins)
+// into pins for the module returned by FlattenModule.
+func FlattenPins(pins Pins) Pins {
+	r := make(Pins, len(pins))
+	for ref, wareID := range pins {
+		r[api.SubmoduleSlotRef{SlotRef: flattenSlotRef(ref)}] = wareID
+	}
+	return r
+}
+
+// NestPins is the inverse of FlattenPins.
+func NestPins(pins Pins) Pins {
+	r := make(Pins, len(pins))
+	for ref, wareID := range pins {
+		at, name := splitFlatName(string(ref.SlotName))
+		r[api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: api.SlotName(name)}}] = wareID
+	}
+	return r
+}
+
+// NestRecords converts the records from evaluating a flattened module
+// (as returned by EvaluateModule) into records for the original module.
+func NestRecords(records map[api.SubmoduleStepRef]api.OperationRecord) map[api.SubmoduleStepRef]api.OperationRecord {
+	r := make(map[api.SubmoduleStepRef]api.OperationRecord, len(records))
+	for ref, record := range records {
+		r[NestStepRef(ref)] = record
+	}
+	return r
+}
+
+// splitFlatName splits a flattened step or slot name at its last dot.
+func splitFlatName(s string) (api.SubmoduleRef, string) {
+	i := strings.LastIndexByte(s, '.')
+	if i < 0 {
+		return "", s
+	}
+	return api.SubmoduleRef(s[:i]), s[i+1:]
+}
+
+/*
+	NestModule is the inverse of FlattenModule: it regroups the steps and
+	imports of a flat module into submodules, by the prefixes of their names.
+
+	The original names of "parent:" imports and submodule exports are lost
+	by flattening, so where a wire crosses a submodule boundary, NestModule
+	makes up new ones: each is named after the flat name of the wire's
+	source, with an underscore prefix and dots replaced by "--" (so the
+	output "out" of the flat step "stepA" is imported into a submodule as
+	"_stepA--out").  Thus the result does the same computation as the
+	original module, but may not be identical to it; flattening the result
+	again gives back the flat module exactly.
+
+	The flat module must not have any "parent:" imports.  Errors will be of
+	category ErrInvalidReference.
+*/
+func NestModule(flat api.Module) (api.Module, error) {
+	root := &nestBuilder{}
+
+	// Imports.
+	slotNames := sortedImportNames(flat)
+	for _, slotName := range slotNames {
+		imp := flat.Imports[slotName]
+		if _, ok := imp.(api.ImportRef_Parent); ok {
+			return api.Module{}, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("cannot nest: flat modules must not have parent imports, but %q is one", slotName),
+				map[string]string{"ref": string(slotName)},
+			)
+		}
+		at, name := splitFlatName(string(slotName))
+		if err := root.at(at).addImport(api.SlotName(name), imp, at); err != nil {
+			return api.Module{}, err
+		}
+	}
+
+	// Steps.
+	stepNames := make([]api.StepName, 0, len(flat.Steps))
+	for stepName := range flat.Steps {
+		stepNames = append(stepNames, stepName)
+	}
+	sort.Slice(stepNames, func(i, j int) bool { return stepNames[i] < stepNames[j] })
+	for _, stepName := range stepNames {
+		op, ok := flat.Steps[stepName].(api.Operation)
+		if !ok {
+			return api.Module{}, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("cannot nest: flat modules must contain only operations, but %q is not one", stepName),
+				map[string]string{"ref": string(stepName)},
+			)
+		}
+		ref := NestStepRef(api.SubmoduleStepRef{StepName: stepName})
+		inputs := make(map[api.AbsPath]api.SlotRef, len(op.Inputs))
+		for path, slotRef := range op.Inputs {
+			wired, err := root.wire(slotRef, ref.SubmoduleRef)
+			if err != nil {
+				return api.Module{}, errcat.AppendDetail(err, "step", string(stepName))
+			}
+			inputs[path] = wired
+		}
+		op.Inputs = inputs
+		b := root.at(ref.SubmoduleRef)
+		if b.steps == nil {
+			b.steps = map[api.StepName]api.Operation{}
+		}
+		b.steps[ref.StepName] = op
+	}
+
+	// Exports.
+	for itemName, slotRef := range flat.Exports {
+		wired, err := root.wire(slotRef, "")
+		if err != nil {
+			return api.Module{}, errcat.AppendDetail(err, "export", string(itemName))
+		}
+		if root.exports == nil {
+			root.exports = map[api.ItemName]api.SlotRef{}
+		}
+		root.exports[itemName] = wired
+	}
+
+	return root.build("")
+}
+
+// nestBuilder accumulates the contents of one (sub)module for NestModule.
+type nestBuilder struct {
+	imports map[api.SlotName]api.ImportRef
+	steps   map[api.StepName]api.Operation
+	subs    map[api.StepName]*nestBuilder
+	exports map[api.ItemName]api.SlotRef
+}
+
+// at returns the builder for the submodule at the given ref, creating it
+// (and any enclosing submodules) as needed.
+func (b *nestBuilder) at(ref api.SubmoduleRef) *nestBuilder {
+	for rest := ref; rest != ""; rest = rest.Decontextualize() {
+		if b.subs == nil {
+			b.subs = map[api.StepName]*nestBuilder{}
+		}
+		sub, ok := b.subs[rest.First()]
+		if !ok {
+			sub = &nestBuilder{}
+			b.subs[rest.First()] = sub
+		}
+		b = sub
+	}
+	return b
+}
+
+func (b *nestBuilder) addImport(slotName api.SlotName, imp api.ImportRef, at api.SubmoduleRef) error {
+	if b.imports == nil {
+		b.imports = map[api.SlotName]api.ImportRef{}
+	}
+	if existing, ok := b.imports[slotName]; ok && existing != imp {
+		return errcat.ErrorDetailed(ErrInvalidReference,
+			fmt.Sprintf("cannot nest: import name %q is used twice in submodule %q", slotName, at),
+			map[string]string{"ref": api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: slotName}}.String()},
+		)
+	}
+	b.imports[slotName] = imp
+	return nil
+}
+
+func (b *nestBuilder) addExport(itemName api.ItemName, slotRef api.SlotRef, at api.SubmoduleRef) error {
+	if b.exports == nil {
+		b.exports = map[api.ItemName]api.SlotRef{}
+	}
+	if existing, ok := b.exports[itemName]; ok && existing != slotRef {
+		return errcat.ErrorDetailed(ErrInvalidReference,
+			fmt.Sprintf("cannot nest: export name %q is used twice in submodule %q", itemName, at),
+			map[string]string{"ref": api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: api.SlotName(itemName)}}.String()},
+		)
+	}
+	b.exports[itemName] = slotRef
+	return nil
+}
+
+// wire takes a SlotRef from the flat module, and returns the SlotRef which
+// refers to the same thing from within the submodule at `to`, adding exports
+// and "parent:" imports to the submodules in between as necessary.
+// (`b` must be the root builder.)
+func (b *nestBuilder) wire(flatRef api.SlotRef, to api.SubmoduleRef) (api.SlotRef, error) {
+	var from api.SubmoduleRef
+	var cur api.SlotRef
+	if flatRef.StepName == "" {
+		at, name := splitFlatName(string(flatRef.SlotName))
+		from, cur = at, api.SlotRef{SlotName: api.SlotName(name)}
+	} else {
+		ref := NestStepRef(api.SubmoduleStepRef{StepName: flatRef.StepName})
+		from, cur = ref.SubmoduleRef, api.SlotRef{StepName: ref.StepName, SlotName: flatRef.SlotName}
+	}
+	name := api.SlotName("_" + strings.Replace(flatRef.String(), ".", "--", -1))
+	common := commonSubmoduleRef(from, to)
+	// Export upwards, out of submodules, until we reach the common ancestor.
+	for at := from; at != common; at = at.Parent() {
+		if err := b.at(at).addExport(api.ItemName(name), cur, at); err != nil {
+			return cur, err
+		}
+		cur = api.SlotRef{StepName: at.Last(), SlotName: name}
+	}
+	// Import downwards, into submodules, until we reach the destination.
+	var path []api.SubmoduleRef
+	for at := to; at != common; at = at.Parent() {
+		path = append(path, at)
+	}
+	for i := len(path) - 1; i >= 0; i-- {
+		if err := b.at(path[i]).addImport(name, api.ImportRef_Parent(cur), path[i]); err != nil {
+			return cur, err
+		}
+		cur = api.SlotRef{SlotName: name}
+	}
+	return cur, nil
+}
+
+func (b *nestBuilder) build(at api.SubmoduleRef) (api.Module, error) {
+	m := api.Module{
+		Imports: b.imports,
+		Steps:   make(map[api.StepName]api.StepUnion, len(b.steps)+len(b.subs)),
+		Exports: b.exports,
+	}
+	for stepName, op := range b.steps {
+		m.Steps[stepName] = op
+	}
+	for stepName, sub := range b.subs {
+		if _, ok := m.Steps[stepName]; ok {
+			return api.Module{}, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("cannot nest: %q is the name of both an operation and a submodule", at.Child(stepName)),
+				map[string]string{"ref": string(at.Child(stepName))},
+			)
+		}
+		subm, err := sub.build(at.Child(stepName))
+		if err != nil {
+			return api.Module{}, err
+		}
+		m.Steps[stepName] = subm
+	}
+	return m, nil
+}
+
+// commonSubmoduleRef returns the innermost submodule enclosing both refs.
+func commonSubmoduleRef(a, b api.SubmoduleRef) api.SubmoduleRef {
+	for ; a != ""; a = a.Parent() {
+		if isWithin(b, a) {
+			return a
+		}
+	}
+	return ""
+}
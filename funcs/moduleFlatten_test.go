@@ -0,0 +1,136 @@
+package funcs
+
+import (
+	"context"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+)
+
+func TestFlattenModule(t *testing.T) {
+	flat, err := FlattenModule(fixtureEvaluationModule())
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, flat, ShouldEqual, Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepA": Operation{
+				Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/src": {"", "src"}},
+				Action:  FormulaAction{Exec: []string{"a"}},
+				Outputs: map[SlotName]AbsPath{"out": "/out"},
+			},
+			"stepB.op": Operation{
+				Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/x": {"stepA", "out"}},
+				Action:  FormulaAction{Exec: []string{"b"}},
+				Outputs: map[SlotName]AbsPath{"out": "/out"},
+			},
+			"stepC": Operation{
+				Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/b": {"stepB.op", "out"}},
+				Action:  FormulaAction{Exec: []string{"c"}},
+				Outputs: map[SlotName]AbsPath{"final": "/b"},
+			},
+		},
+		Exports: map[ItemName]SlotRef{
+			"src":             {"", "src"},
+			"bin-linux-amd64": {"stepC", "final"},
+		},
+	})
+
+	t.Run("nesting", func(t *testing.T) {
+		nested, err := NestModule(flat)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, nested, ShouldEqual, Module{
+			Imports: map[SlotName]ImportRef{
+				"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+				"src":  ImportRef_Ingest{"git", ".:HEAD"},
+			},
+			Steps: map[StepName]StepUnion{
+				"stepA": Operation{
+					Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/src": {"", "src"}},
+					Action:  FormulaAction{Exec: []string{"a"}},
+					Outputs: map[SlotName]AbsPath{"out": "/out"},
+				},
+				"stepB": Module{
+					Imports: map[SlotName]ImportRef{
+						"_base":       ImportRef_Parent{"", "base"},
+						"_stepA--out": ImportRef_Parent{"stepA", "out"},
+					},
+					Steps: map[StepName]StepUnion{
+						"op": Operation{
+							Inputs:  map[AbsPath]SlotRef{"/": {"", "_base"}, "/x": {"", "_stepA--out"}},
+							Action:  FormulaAction{Exec: []string{"b"}},
+							Outputs: map[SlotName]AbsPath{"out": "/out"},
+						},
+					},
+					Exports: map[ItemName]SlotRef{"_stepB--op--out": {"op", "out"}},
+				},
+				"stepC": Operation{
+					Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/b": {"stepB", "_stepB--op--out"}},
+					Action:  FormulaAction{Exec: []string{"c"}},
+					Outputs: map[SlotName]AbsPath{"final": "/b"},
+				},
+			},
+			Exports: map[ItemName]SlotRef{
+				"src":             {"", "src"},
+				"bin-linux-amd64": {"stepC", "final"},
+			},
+		})
+		reflat, err := FlattenModule(nested)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, reflat, ShouldEqual, flat)
+	})
+	t.Run("nested imports roundtrip", func(t *testing.T) {
+		module := Module{
+			Imports: map[SlotName]ImportRef{
+				"base": ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			},
+			Steps: map[StepName]StepUnion{
+				"stepSub": Module{
+					Imports: map[SlotName]ImportRef{
+						"base": ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+						"up":   ImportRef_Parent{"", "base"},
+					},
+					Steps: map[StepName]StepUnion{
+						"op": Operation{
+							Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/up": {"", "up"}},
+							Outputs: map[SlotName]AbsPath{"out": "/out"},
+						},
+					},
+					Exports: map[ItemName]SlotRef{"out": {"op", "out"}},
+				},
+			},
+			Exports: map[ItemName]SlotRef{"out": {"stepSub", "out"}},
+		}
+		flat, err := FlattenModule(module)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, flat.Imports["stepSub.base"], ShouldEqual, ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"})
+		nested, err := NestModule(flat)
+		Wish(t, err, ShouldEqual, nil)
+		reflat, err := FlattenModule(nested)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, reflat, ShouldEqual, flat)
+		pins := Pins{
+			{"", SlotRef{"", "base"}}:        {"tar", "base1"},
+			{"stepSub", SlotRef{"", "base"}}: {"tar", "base2"},
+		}
+		Wish(t, NestPins(FlattenPins(pins)), ShouldEqual, pins)
+	})
+	t.Run("evaluating flat agrees with nested", func(t *testing.T) {
+		exports, records, err := EvaluateModule(context.Background(),
+			fixtureEvaluationModule(), fixtureEvaluationPins(),
+			WareSourcing{}, WareStaging{}, (&fakeRunner{}).Run,
+		)
+		Wish(t, err, ShouldEqual, nil)
+		flatExports, flatRecords, err := EvaluateModule(context.Background(),
+			flat, FlattenPins(fixtureEvaluationPins()),
+			WareSourcing{}, WareStaging{}, (&fakeRunner{}).Run,
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, flatExports, ShouldEqual, exports)
+		Wish(t, NestRecords(flatRecords), ShouldEqual, records)
+	})
+}
@@ -0,0 +1,149 @@
+package funcs
+
+import (
+	"sort"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+/*
+	ModuleImpact returns every step and every export of the module which is
+	affected (directly or transitively) by a change to the given imports
+	and steps.  This is the set of things that must be re-evaluated when,
+	for example, a new release of an upstream module is adopted.
+
+	Changed imports are SubmoduleSlotRefs with no StepName (e.g. "base",
+	or "stepB.base" for an import of submodule "stepB").  They're traced
+	to their source as by BindOperation, so naming a "parent:" import
+	is the same as naming whatever it refers to.
+
+	Changed steps may be Operations or submodules; a changed submodule
+	affects every Operation within it.
+
+	The walk follows data flow across submodule boundaries: into submodules
+	via "parent:" imports, and out of them via their exports.  The affected
+	steps are returned in the order given by ModuleOrderStepsDeep; they
+	include every affected Operation, and every submodule step which
+	contains one.  The affected exports (of the root module) are sorted.
+
+	Errors will be of the categories returned by ModuleOrderStepsDeep,
+	or ErrInvalidReference if one of the changed imports or steps doesn't exist.
+*/
+func ModuleImpact(
+	m api.Module,
+	changedImports []api.SubmoduleSlotRef,
+	changedSteps []api.SubmoduleStepRef,
+) (StepTree, []api.ItemName, error) {
+	all, err := ModuleOrderStepsDeep(m)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Gather the initial changes.
+	changedSources := map[api.SubmoduleSlotRef]struct{}{}
+	for _, ref := range changedImports {
+		if ref.StepName != "" {
+			return nil, nil, errcat.ErrorDetailed(ErrInvalidReference,
+				"changed imports must not refer to a step",
+				map[string]string{"ref": ref.String()},
+			)
+		}
+		src, err := traceSlotRef(m, ref)
+		if err != nil {
+			return nil, nil, err
+		}
+		changedSources[src] = struct{}{}
+	}
+	affected := map[api.SubmoduleStepRef]struct{}{}
+	for _, stepRef := range changedSteps {
+		mod, err := moduleAt(m, stepRef.SubmoduleRef)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch mod.Steps[stepRef.StepName].(type) {
+		case api.Operation:
+			affected[stepRef] = struct{}{}
+		case api.Module:
+			affected[stepRef] = struct{}{}
+			within := stepRef.SubmoduleRef.Child(stepRef.StepName)
+			for _, other := range all {
+				if isWithin(other.SubmoduleRef, within) {
+					affected[other] = struct{}{}
+				}
+			}
+		default:
+			return nil, nil, errcat.ErrorDetailed(ErrInvalidReference,
+				"changed step does not exist",
+				map[string]string{"ref": stepRef.String()},
+			)
+		}
+	}
+	isAffected := func(src api.SubmoduleSlotRef) bool {
+		// A changed import may trace to a step output (if it's a "parent:" import), so check every source.
+		if _, ok := changedSources[src]; ok {
+			return true
+		}
+		if src.StepName == "" {
+			return false
+		}
+		_, ok := affected[api.SubmoduleStepRef{SubmoduleRef: src.SubmoduleRef, StepName: src.StepName}]
+		return ok
+	}
+
+	// Propagate forward.  Steps are in dependency order, so one pass suffices.
+	for _, stepRef := range all {
+		op, err := operationAt(m, stepRef)
+		if err != nil {
+			continue // submodules are dealt with below.
+		}
+		for _, slotRef := range op.Inputs {
+			src, err := traceSlotRef(m, api.SubmoduleSlotRef{SubmoduleRef: stepRef.SubmoduleRef, SlotRef: slotRef})
+			if err != nil {
+				return nil, nil, errcat.AppendDetail(err, "step", stepRef.String())
+			}
+			if isAffected(src) {
+				affected[stepRef] = struct{}{}
+				break
+			}
+		}
+	}
+
+	// Mark the submodules enclosing affected operations.
+	for stepRef := range affected {
+		for sub := stepRef.SubmoduleRef; sub != ""; sub = sub.Parent() {
+			affected[api.SubmoduleStepRef{SubmoduleRef: sub.Parent(), StepName: sub.Last()}] = struct{}{}
+		}
+	}
+	var steps StepTree
+	for _, stepRef := range all {
+		if _, ok := affected[stepRef]; ok {
+			steps = append(steps, stepRef)
+		}
+	}
+
+	// Check exports.
+	var exports []api.ItemName
+	for itemName, slotRef := range m.Exports {
+		src, err := traceSlotRef(m, api.SubmoduleSlotRef{SlotRef: slotRef})
+		if err != nil {
+			return nil, nil, errcat.AppendDetail(err, "export", string(itemName))
+		}
+		if isAffected(src) {
+			exports = append(exports, itemName)
+		}
+	}
+	sort.Slice(exports, func(i, j int) bool { return exports[i] < exports[j] })
+	return steps, exports, nil
+}
+
+// isWithin returns true if `ref` is the submodule `outer`, or is nested inside it.
+func isWithin(ref, outer api.SubmoduleRef) bool {
+	for ; ref != ""; ref = ref.Parent() {
+		if ref == outer {
+			return true
+		}
+	}
+	return false
+}
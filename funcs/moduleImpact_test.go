@@ -0,0 +1,148 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+)
+
+func TestModuleImpact(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+			"foo":  ImportRef_Ingest{"git", ".:HEAD"},
+			"bar":  ImportRef_Catalog{"publishing.group/bar", "v2.0", "bin-linux-amd64"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepA": Operation{
+				Inputs: map[AbsPath]SlotRef{
+					"/":    {"", "base"},
+					"/foo": {"", "foo"},
+					"/bar": {"", "bar"},
+				},
+				Action: FormulaAction{Exec: []string{"mv", "/foo/thinger", "/out/thinger"}},
+				Outputs: map[SlotName]AbsPath{
+					"intermediate": "/out",
+				},
+			},
+			"stepB": Module{
+				Imports: map[SlotName]ImportRef{
+					"base":   ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+					"bar":    ImportRef_Catalog{"publishing.group/bar", "v2.2", "bin-linux-amd64"}, // n.b. submodule uses different version of bar than parent; that's allowed.
+					"wodget": ImportRef_Parent{"stepA", "intermediate"},
+				},
+				Steps: map[StepName]StepUnion{
+					"op": Operation{
+						Inputs: map[AbsPath]SlotRef{
+							"/":    {"", "base"},
+							"/bar": {"", "bar"},
+							"/src": {"", "wodget"},
+						},
+						Action: FormulaAction{Exec: []string{"/bar/tool", "/src", "/out/thinger"}},
+						Outputs: map[SlotName]AbsPath{
+							"intermediate": "/out",
+						},
+					},
+				},
+				Exports: map[ItemName]SlotRef{"barred": {"op", "intermediate"}},
+			},
+			"stepC": Operation{
+				Inputs: map[AbsPath]SlotRef{
+					"/":    {"", "base"},
+					"/bar": {"stepB", "barred"},
+				},
+				Action: FormulaAction{Exec: []string{"/bar/thinger"}},
+				Outputs: map[SlotName]AbsPath{
+					"final": "/bar",
+				},
+			},
+		},
+		Exports: map[ItemName]SlotRef{
+			"src":             {"", "foo"},
+			"bin-linux-amd64": {"stepC", "final"},
+		},
+	}
+	t.Run("root import change should reach into submodules", func(t *testing.T) {
+		steps, exports, err := ModuleImpact(module,
+			[]SubmoduleSlotRef{{"", SlotRef{"", "bar"}}}, nil)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, steps, ShouldEqual, StepTree{
+			{"", "stepA"},
+			{"", "stepB"},
+			{"stepB", "op"},
+			{"", "stepC"},
+		})
+		Wish(t, exports, ShouldEqual, []ItemName{"bin-linux-amd64"})
+	})
+	t.Run("submodule import change should reach out through exports", func(t *testing.T) {
+		steps, exports, err := ModuleImpact(module,
+			[]SubmoduleSlotRef{{"stepB", SlotRef{"", "bar"}}}, nil)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, steps, ShouldEqual, StepTree{
+			{"", "stepB"},
+			{"stepB", "op"},
+			{"", "stepC"},
+		})
+		Wish(t, exports, ShouldEqual, []ItemName{"bin-linux-amd64"})
+	})
+	t.Run("submodule import of a step output should affect its consumers", func(t *testing.T) {
+		// "stepB.wodget" is a parent import of stepA's output; stepA itself isn't changed.
+		steps, exports, err := ModuleImpact(module,
+			[]SubmoduleSlotRef{{"stepB", SlotRef{"", "wodget"}}}, nil)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, steps, ShouldEqual, StepTree{
+			{"", "stepB"},
+			{"stepB", "op"},
+			{"", "stepC"},
+		})
+		Wish(t, exports, ShouldEqual, []ItemName{"bin-linux-amd64"})
+	})
+	t.Run("directly exported imports should be affected", func(t *testing.T) {
+		_, exports, err := ModuleImpact(module,
+			[]SubmoduleSlotRef{{"", SlotRef{"", "foo"}}}, nil)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, exports, ShouldEqual, []ItemName{"bin-linux-amd64", "src"})
+	})
+	t.Run("changed leaf step", func(t *testing.T) {
+		steps, exports, err := ModuleImpact(module,
+			nil, []SubmoduleStepRef{{"", "stepC"}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, steps, ShouldEqual, StepTree{{"", "stepC"}})
+		Wish(t, exports, ShouldEqual, []ItemName{"bin-linux-amd64"})
+	})
+	t.Run("changed step in a larger graph", func(t *testing.T) {
+		steps, exports, err := ModuleImpact(fixtureComplexOrderingModule(),
+			nil, []SubmoduleStepRef{{"", "stepF"}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, steps, ShouldEqual, StepTree{
+			{"", "stepF"},
+			{"", "stepG"},
+			{"", "stepI"},
+			{"", "stepJ"},
+			{"", "stepL"},
+			{"", "stepM"},
+		})
+		Wish(t, len(exports), ShouldEqual, 0)
+	})
+	t.Run("changed submodule", func(t *testing.T) {
+		steps, _, err := ModuleImpact(module,
+			nil, []SubmoduleStepRef{{"", "stepB"}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, steps, ShouldEqual, StepTree{
+			{"", "stepB"},
+			{"stepB", "op"},
+			{"", "stepC"},
+		})
+	})
+	t.Run("nonexistent changes should be rejected", func(t *testing.T) {
+		_, _, err := ModuleImpact(module,
+			[]SubmoduleSlotRef{{"", SlotRef{"", "nope"}}}, nil)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidReference)
+		_, _, err = ModuleImpact(module,
+			nil, []SubmoduleStepRef{{"stepB", "nope"}})
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidReference)
+	})
+}
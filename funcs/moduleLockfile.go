@@ -0,0 +1,192 @@
+package funcs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/hitch"
+)
+
+/*
+	Lockfile records the result of ResolvePins, so that a module can be
+	resolved again later to exactly the same wares, even if the catalogs
+	it imports from have moved on since.
+
+	Pins are keyed by SubmoduleSlotRef.String(): e.g. "base" for an import
+	in the root module, or "stepB.base" for an import in submodule "stepB".
+	(Pins never refer to step outputs, so the key is unambiguous.)
+
+	The serial form is JSON with sorted keys, so it's deterministic and
+	diffs nicely.
+*/
+type Lockfile struct {
+	Pins     map[string]api.WareID
+	Sourcing api.WareSourcing
+}
+
+var (
+	Lockfile_AtlasEntry = atlas.BuildEntry(Lockfile{}).StructMap().Autogenerate().Complete()
+)
+
+var Atlas_Lockfile = atlas.MustBuild(
+	Lockfile_AtlasEntry,
+	api.WareSourcing_AtlasEntry,
+	api.WareID_AtlasEntry,
+)
+
+// NewLockfile builds a Lockfile from the results of ResolvePins.
+func NewLockfile(pins Pins, ws api.WareSourcing) Lockfile {
+	l := Lockfile{
+		Pins:     make(map[string]api.WareID, len(pins)),
+		Sourcing: ws,
+	}
+	for ref, wareID := range pins {
+		l.Pins[ref.String()] = wareID
+	}
+	return l
+}
+
+// ParsePins returns the lockfile's pins in the form ResolvePins returns them.
+//
+// Errors will be of category ErrInvalidLockfile.
+func (l Lockfile) ParsePins() (Pins, error) {
+	pins := make(Pins, len(l.Pins))
+	for k, wareID := range l.Pins {
+		ref, err := parsePinKey(k)
+		if err != nil {
+			return nil, err
+		}
+		pins[ref] = wareID
+	}
+	return pins, nil
+}
+
+func parsePinKey(k string) (api.SubmoduleSlotRef, error) {
+	if k == "" {
+		return api.SubmoduleSlotRef{}, errcat.Errorf(ErrInvalidLockfile, "lockfile pin key cannot be empty")
+	}
+	i := strings.LastIndexByte(k, '.')
+	if i < 0 {
+		return api.SubmoduleSlotRef{"", api.SlotRef{"", api.SlotName(k)}}, nil
+	}
+	if i == 0 || i == len(k)-1 {
+		return api.SubmoduleSlotRef{}, errcat.Errorf(ErrInvalidLockfile, "lockfile pin key %q is malformed", k)
+	}
+	return api.SubmoduleSlotRef{api.SubmoduleRef(k[:i]), api.SlotRef{"", api.SlotName(k[i+1:])}}, nil
+}
+
+// MarshalLockfile returns the serial form of a Lockfile:
+// indented JSON with sorted keys.
+func MarshalLockfile(l Lockfile) []byte {
+	bs, err := refmt.MarshalAtlased(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, l, Atlas_Lockfile)
+	if err != nil {
+		panic(err) // the atlas covers the whole type; this can't fail.
+	}
+	return bs
+}
+
+// UnmarshalLockfile parses the serial form of a Lockfile.
+//
+// Errors will be of category ErrInvalidLockfile.
+func UnmarshalLockfile(bs []byte) (*Lockfile, error) {
+	var l Lockfile
+	if err := refmt.UnmarshalAtlased(json.DecodeOptions{}, bs, &l, Atlas_Lockfile); err != nil {
+		return nil, errcat.Errorf(ErrInvalidLockfile, "cannot parse lockfile: %s", err)
+	}
+	return &l, nil
+}
+
+/*
+	ResolvePinsFromLockfile is an alternative to ResolvePins which takes
+	pins from a Lockfile, rather than looking them up in catalogs and
+	running ingests.
+
+	Every catalog and ingest import in the module (and its submodules)
+	must have a pin in the lockfile; if any don't, the lockfile is stale,
+	and an error of category ErrStaleLockfile is returned.  Pins in the
+	lockfile which the module doesn't use are ignored.  A lockfile with a
+	malformed pin key is rejected with ErrInvalidLockfile.
+
+	The WareSourcing returned is the lockfile's, in full.
+*/
+func ResolvePinsFromLockfile(m api.Module, l Lockfile) (Pins, *api.WareSourcing, error) {
+	locked, err := l.ParsePins()
+	if err != nil {
+		return nil, nil, err
+	}
+	r := make(Pins)
+	for _, ref := range sortedImportRefs(PinnedImports(m)) {
+		wareID, ok := locked[ref]
+		if !ok {
+			return nil, nil, errcat.ErrorDetailed(ErrStaleLockfile,
+				fmt.Sprintf("lockfile has no pin for import %q", ref),
+				map[string]string{"ref": ref.String()},
+			)
+		}
+		r[ref] = wareID
+	}
+	ws := l.Sourcing
+	return r, &ws, nil
+}
+
+// PinDrift describes a catalog import which resolves differently today than
+// it did when the lockfile was made.
+type PinDrift struct {
+	Ref     api.SubmoduleSlotRef
+	Import  api.ImportRef_Catalog
+	Locked  api.WareID // Zero if the lockfile has no pin for this import.
+	Current api.WareID
+}
+
+/*
+	CheckPinDrift resolves every catalog import in the module (recursively)
+	against the catalogs as they are now, and reports each one which resolves
+	to a different WareID than the lockfile says (or which the lockfile has
+	no pin for).  The result is sorted by Ref, and is empty if the lockfile
+	is up to date.
+
+	Ingest imports aren't checked: doing so would mean running the ingests.
+
+	Lineages are fetched as by ResolvePinsContext, with at most `limit`
+	fetches in flight at once.  (Warehouses aren't needed, so they aren't
+	fetched.)
+*/
+func CheckPinDrift(
+	ctx context.Context,
+	m api.Module,
+	l Lockfile,
+	viewLineageTool hitch.ViewLineageTool,
+	limit int,
+) ([]PinDrift, error) {
+	locked, err := l.ParsePins()
+	if err != nil {
+		return nil, err
+	}
+	imports := PinnedImports(m)
+	cache, err := fetchCatalogs(ctx, catalogModuleNames(imports), viewLineageTool, nil, limit)
+	if err != nil {
+		return nil, err
+	}
+	var r []PinDrift
+	for _, ref := range sortedImportRefs(imports) {
+		impRef, ok := imports[ref].(api.ImportRef_Catalog)
+		if !ok {
+			continue
+		}
+		current, err := hitch.LineagePluckReleaseItem(cache[impRef.ModuleName].lineage, impRef.ReleaseName, impRef.ItemName)
+		if err != nil {
+			return nil, err
+		}
+		if lockedWareID, ok := locked[ref]; !ok || lockedWareID != *current {
+			r = append(r, PinDrift{Ref: ref, Import: impRef, Locked: lockedWareID, Current: *current})
+		}
+	}
+	return r, nil
+}
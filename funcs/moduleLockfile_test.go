@@ -0,0 +1,142 @@
+package funcs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+	mockhitch "github.com/polydawn/go-timeless-api/hitch/mock"
+)
+
+func TestLockfile(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepSub": Module{Imports: map[SlotName]ImportRef{
+				"base": ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+			}},
+		},
+	}
+	pins := Pins{
+		{"", SlotRef{"", "base"}}:        {"tar", "base1"},
+		{"", SlotRef{"", "src"}}:         {"git", "f00f"},
+		{"stepSub", SlotRef{"", "base"}}: {"tar", "base2"},
+	}
+	ws := WareSourcing{ByModule: map[ModuleName]map[PackType][]WarehouseLocation{
+		"example.org/base": {"tar": {"https://example.org/base/"}},
+	}}
+	lock := NewLockfile(pins, ws)
+	t.Run("serial form should be deterministic", func(t *testing.T) {
+		Wish(t, string(MarshalLockfile(lock)), ShouldEqual, `{
+	"pins": {
+		"base": "tar:base1",
+		"src": "git:f00f",
+		"stepSub.base": "tar:base2"
+	},
+	"sourcing": {
+		"byModule": {
+			"example.org/base": {
+				"tar": [
+					"https://example.org/base/"
+				]
+			}
+		}
+	}
+}
+`)
+	})
+	t.Run("roundtrip", func(t *testing.T) {
+		lock2, err := UnmarshalLockfile(MarshalLockfile(lock))
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, *lock2, ShouldEqual, lock)
+		pins2, err := lock2.ParsePins()
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, pins2, ShouldEqual, pins)
+	})
+	t.Run("resolve from lockfile", func(t *testing.T) {
+		pins2, ws2, err := ResolvePinsFromLockfile(module, lock)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, pins2, ShouldEqual, pins)
+		Wish(t, *ws2, ShouldEqual, ws)
+	})
+	t.Run("resolve from stale lockfile", func(t *testing.T) {
+		stale := NewLockfile(pins, ws)
+		delete(stale.Pins, "stepSub.base")
+		_, _, err := ResolvePinsFromLockfile(module, stale)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrStaleLockfile)
+		Wish(t, errcat.Details(err), ShouldEqual, map[string]string{"ref": "stepSub.base"})
+	})
+	t.Run("unparsable lockfile", func(t *testing.T) {
+		_, err := UnmarshalLockfile([]byte(`{"Pins": 12}`))
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidLockfile)
+	})
+	t.Run("malformed pin keys", func(t *testing.T) {
+		for _, k := range []string{"", ".base", "stepSub."} {
+			corrupt := NewLockfile(pins, ws)
+			corrupt.Pins[k] = WareID{"tar", "base1"}
+			_, _, err := ResolvePinsFromLockfile(module, corrupt)
+			Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidLockfile)
+			_, err = CheckPinDrift(context.Background(), module, corrupt, mockhitch.Fixture{}.ViewLineage, 0)
+			Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidLockfile)
+		}
+	})
+}
+
+func TestPinDrift(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepSub": Module{Imports: map[SlotName]ImportRef{
+				"base": ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+			}},
+		},
+	}
+	catalog := mockhitch.Fixture{
+		map[ModuleName]Lineage{
+			"example.org/base": Lineage{"example.org/base", []Release{
+				{Name: "v2", Items: map[ItemName]WareID{"linux-amd64": {"tar", "base2"}}},
+				{Name: "v1", Items: map[ItemName]WareID{"linux-amd64": {"tar", "base1"}}},
+			}},
+		},
+	}
+	pins := Pins{
+		{"", SlotRef{"", "base"}}:        {"tar", "base1"},
+		{"", SlotRef{"", "src"}}:         {"git", "f00f"},
+		{"stepSub", SlotRef{"", "base"}}: {"tar", "base2"},
+	}
+	t.Run("up to date", func(t *testing.T) {
+		drift, err := CheckPinDrift(context.Background(), module, NewLockfile(pins, WareSourcing{}), catalog.ViewLineage, 0)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, len(drift), ShouldEqual, 0)
+	})
+	t.Run("moved and missing pins", func(t *testing.T) {
+		lock := NewLockfile(pins, WareSourcing{})
+		lock.Pins["stepSub.base"] = WareID{"tar", "old"}
+		delete(lock.Pins, "base")
+		lock.Pins["src"] = WareID{"git", "ingests-are-not-checked"}
+		drift, err := CheckPinDrift(context.Background(), module, lock, catalog.ViewLineage, 0)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, drift, ShouldEqual, []PinDrift{
+			{
+				Ref:     SubmoduleSlotRef{"", SlotRef{"", "base"}},
+				Import:  ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+				Current: WareID{"tar", "base1"},
+			},
+			{
+				Ref:     SubmoduleSlotRef{"stepSub", SlotRef{"", "base"}},
+				Import:  ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+				Locked:  WareID{"tar", "old"},
+				Current: WareID{"tar", "base2"},
+			},
+		})
+	})
+}
@@ -44,6 +44,9 @@ func (t StepTree) DetachSubtree(submoduleName api.StepName) StepTree {
 /*
 	ModuleOrderStepsDeep is like ModuleOrderSteps, but returns *all* steps, recursively
 	including all submodules and their steps.
+
+	Errors are as for ModuleOrderSteps; errors found within submodules have
+	their step references contextualized, so they refer to the full path.
 */
 func ModuleOrderStepsDeep(m api.Module) (r StepTree, _ error) {
 	levelOrder, err := ModuleOrderSteps(m)
@@ -58,7 +61,7 @@ func ModuleOrderStepsDeep(m api.Module) (r StepTree, _ error) {
 			r = append(r, api.SubmoduleStepRef{"", stepName})
 			subOrder, err := ModuleOrderStepsDeep(x)
 			if err != nil {
-				return nil, err
+				return nil, contextualizeError(err, stepName)
 			}
 			r = r.AppendSubtree(stepName, subOrder)
 		}
@@ -76,6 +79,13 @@ func ModuleOrderStepsDeep(m api.Module) (r StepTree, _ error) {
 	understanding and the simplicity of predicting the result of the sort
 	is more important than cleverness; so is the regional stability of the
 	sort in the face of changes in other parts of the graph.
+
+	If the steps don't form a DAG, the error is a CycleError
+	(of category ErrModuleCycle), which lists every step in the loop.
+	If a step has an input (or, for submodules, a parent import) which
+	doesn't point at anything, the error is a ReferenceError, of category
+	ErrMissingImport, ErrMissingStep, or ErrMissingOutput; a submodule
+	with an ingest import gets a ReferenceError of category ErrInvalidImport.
 */
 func ModuleOrderSteps(m api.Module) (StepList, error) {
 	// Alloc result accumulator.
@@ -93,7 +103,7 @@ func ModuleOrderSteps(m api.Module) (StepList, error) {
 	sort.Sort(stepsOrdered)
 	// For each step: visit.  (This will recurse, and no-op itself internally as approrpriate for visited nodes.)
 	for _, step := range stepsOrdered {
-		if err := orderSteps_visit(step, todo, map[api.StepName]struct{}{}, &result, m); err != nil {
+		if err := orderSteps_visit(step, todo, nil, &result, m); err != nil {
 			return nil, err
 		}
 	}
@@ -118,7 +128,7 @@ func (s stepNames) Less(i, j int) bool { return s[i] < s[j] }
 func orderSteps_visit(
 	node api.StepName,
 	todo map[api.StepName]struct{},
-	loopDetector map[api.StepName]struct{},
+	visiting []api.StepName,
 	result *[]api.StepName,
 	m api.Module,
 ) error {
@@ -126,39 +136,45 @@ func orderSteps_visit(
 	if _, ok := todo[node]; !ok {
 		return nil
 	}
-	if _, ok := loopDetector[node]; ok {
-		return fmt.Errorf("not a dag: loop detected at %q", node)
+	for i, step := range visiting {
+		if step == node {
+			// Each step in `visiting` depends on the next; report the loop in that direction.
+			cycle := make([]api.SubmoduleStepRef, 0, len(visiting)-i+1)
+			for _, step := range visiting[i:] {
+				cycle = append(cycle, api.SubmoduleStepRef{"", step})
+			}
+			return CycleError{append(cycle, api.SubmoduleStepRef{"", node})}
+		}
 	}
 	// Mark self for loop detection.
-	loopDetector[node] = struct{}{}
+	visiting = append(visiting, node)
+	// Submodules can't have ingest imports.
+	if sub, ok := m.Steps[node].(api.Module); ok {
+		for _, slotName := range sortedImportNames(sub) {
+			if _, ok := sub.Imports[slotName].(api.ImportRef_Ingest); ok {
+				return ReferenceError{ErrInvalidImport, api.SubmoduleStepRef{"", node}, api.SlotRef{"", slotName},
+					"ingest imports are only allowed in the root module"}
+			}
+		}
+	}
 	// Extract any imports which are dependency wiring.
+	//  Sort the dependency nodes by name, then recurse.
+	//  This sort is necessary for deterministic order of unrelated nodes (and errors).
 	wires := inputSlotRefs(m.Steps[node])
+	sort.Sort(slotRefs(wires))
 	// Check that those actually point somewhere.
 	for _, wire := range wires {
 		// TODO: all of these name existence checks should be done linearly up front (... also).
-		// FIXME: these error strings are not great for submodules; they forgot the "parent:" part.
-		switch wire.StepName == "" {
-		case true:
-			if _, ok := m.Imports[wire.SlotName]; !ok {
-				return fmt.Errorf("step %q has an invalid reference to %q: %q is not the name of an import in this module", node, wire, wire.SlotName)
-			}
-		case false:
-			if op, ok := m.Steps[wire.StepName]; !ok {
-				return fmt.Errorf("step %q has an invalid reference to %q: %q is not the name of a step in this module", node, wire, wire.StepName)
-			} else if _, ok := outputSlotReferences(op)[wire.SlotName]; !ok {
-				return fmt.Errorf("step %q has an invalid reference to %q: step %q has no output named %s", node, wire, wire.StepName, wire.SlotName)
-			}
+		if err := orderSteps_checkWire(node, wire, m); err != nil {
+			return err
 		}
 	}
-	// Sort the dependency nodes by name, then recurse.
-	//  This sort is necessary for deterministic order of unrelated nodes.
-	sort.Sort(slotRefs(wires))
 	for _, wire := range wires {
 		switch wire.StepName == "" {
 		case true:
 			// pass!  it's a reference a module import; no recursion to do.
 		case false:
-			if err := orderSteps_visit(wire.StepName, todo, loopDetector, result, m); err != nil {
+			if err := orderSteps_visit(wire.StepName, todo, visiting, result, m); err != nil {
 				return err
 			}
 		}
@@ -169,6 +185,34 @@ func orderSteps_visit(
 	return nil
 }
 
+// orderSteps_checkWire returns a ReferenceError if the wire doesn't point
+// at an import or step output in the module.  For submodules, the wire is
+// one of its parent imports, and the reasons are phrased as such.
+func orderSteps_checkWire(node api.StepName, wire api.SlotRef, m api.Module) error {
+	describe := func(reason string) string {
+		if _, ok := m.Steps[node].(api.Module); ok {
+			return fmt.Sprintf("parent import %q is invalid: %s", api.ImportRef_Parent(wire), reason)
+		}
+		return reason
+	}
+	switch wire.StepName == "" {
+	case true:
+		if _, ok := m.Imports[wire.SlotName]; !ok {
+			return ReferenceError{ErrMissingImport, api.SubmoduleStepRef{"", node}, wire,
+				describe(fmt.Sprintf("%q is not the name of an import in this module", wire.SlotName))}
+		}
+	case false:
+		if op, ok := m.Steps[wire.StepName]; !ok {
+			return ReferenceError{ErrMissingStep, api.SubmoduleStepRef{"", node}, wire,
+				describe(fmt.Sprintf("%q is not the name of a step in this module", wire.StepName))}
+		} else if _, ok := outputSlotReferences(op)[wire.SlotName]; !ok {
+			return ReferenceError{ErrMissingOutput, api.SubmoduleStepRef{"", node}, wire,
+				describe(fmt.Sprintf("step %q has no output named %q", wire.StepName, wire.SlotName))}
+		}
+	}
+	return nil
+}
+
 type slotRefs []api.SlotRef
 
 func (s slotRefs) Len() int      { return len(s) }
@@ -192,8 +236,7 @@ func inputSlotRefs(s api.StepUnion) (r []api.SlotRef) {
 			case api.ImportRef_Parent:
 				r = append(r, api.SlotRef(imp2))
 			case api.ImportRef_Ingest:
-				// this is panic-worthy because it should've been checked earlier.
-				panic("submodules can't have ingest imports!")
+				// pass; not allowed, but orderSteps_visit rejects these.
 			}
 		}
 		return r
@@ -217,3 +260,13 @@ func outputSlotReferences(s api.StepUnion) map[api.SlotName]struct{} {
 	}
 	panic("unreachable")
 }
+
+// sortedImportNames returns the names of the module's imports, sorted.
+func sortedImportNames(m api.Module) []api.SlotName {
+	r := make([]api.SlotName, 0, len(m.Imports))
+	for slotName := range m.Imports {
+		r = append(r, slotName)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i] < r[j] })
+	return r
+}
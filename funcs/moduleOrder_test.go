@@ -3,6 +3,7 @@ package funcs
 import (
 	"testing"
 
+	"github.com/warpfork/go-errcat"
 	. "github.com/warpfork/go-wish"
 
 	api "github.com/polydawn/go-timeless-api"
@@ -281,3 +282,135 @@ func TestStepTreeDetach(t *testing.T) {
 }
 
 // TODO referential integrity checks: exports must actually refer to local outputs or imports
+
+func TestOrderingErrors(t *testing.T) {
+	t.Run("cycles should report the whole loop", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepA": api.Operation{
+				Inputs:  map[api.AbsPath]api.SlotRef{"/": {"stepC", "out"}},
+				Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+			},
+			"stepB": api.Operation{
+				Inputs:  map[api.AbsPath]api.SlotRef{"/": {"stepA", "out"}},
+				Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+			},
+			"stepC": api.Operation{
+				Inputs:  map[api.AbsPath]api.SlotRef{"/": {"stepB", "out"}},
+				Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+			},
+		}}
+		_, err := ModuleOrderSteps(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrModuleCycle)
+		Wish(t, err.(CycleError).Cycle, ShouldEqual, []api.SubmoduleStepRef{
+			{"", "stepA"},
+			{"", "stepC"},
+			{"", "stepB"},
+			{"", "stepA"},
+		})
+		Wish(t, errcat.Details(err)["cycle"], ShouldEqual, "stepA,stepC,stepB,stepA")
+	})
+	t.Run("cycles in submodules should be contextualized", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepSub": api.Module{Steps: map[api.StepName]api.StepUnion{
+				"stepX": api.Operation{
+					Inputs:  map[api.AbsPath]api.SlotRef{"/": {"stepY", "out"}},
+					Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+				},
+				"stepY": api.Operation{
+					Inputs:  map[api.AbsPath]api.SlotRef{"/": {"stepX", "out"}},
+					Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+				},
+			}},
+		}}
+		_, err := ModuleOrderStepsDeep(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrModuleCycle)
+		Wish(t, err.(CycleError).Cycle, ShouldEqual, []api.SubmoduleStepRef{
+			{"stepSub", "stepX"},
+			{"stepSub", "stepY"},
+			{"stepSub", "stepX"},
+		})
+	})
+	t.Run("self-reference is a cycle", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepA": api.Operation{
+				Inputs:  map[api.AbsPath]api.SlotRef{"/": {"stepA", "out"}},
+				Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+			},
+		}}
+		_, err := ModuleOrderSteps(basting)
+		Wish(t, err.(CycleError).Cycle, ShouldEqual, []api.SubmoduleStepRef{
+			{"", "stepA"},
+			{"", "stepA"},
+		})
+	})
+	t.Run("missing import", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepA": api.Operation{Inputs: map[api.AbsPath]api.SlotRef{"/": {"", "nope"}}},
+		}}
+		_, err := ModuleOrderSteps(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrMissingImport)
+		Wish(t, errcat.Details(err), ShouldEqual, map[string]string{
+			"step":   "stepA",
+			"slot":   "nope",
+			"reason": `"nope" is not the name of an import in this module`,
+		})
+	})
+	t.Run("missing step", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepA": api.Operation{Inputs: map[api.AbsPath]api.SlotRef{"/": {"stepZ", "out"}}},
+		}}
+		_, err := ModuleOrderSteps(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrMissingStep)
+		Wish(t, err.(ReferenceError).Slot, ShouldEqual, api.SlotRef{"stepZ", "out"})
+	})
+	t.Run("missing output, via a submodule's parent import", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepA": api.Operation{Outputs: map[api.SlotName]api.AbsPath{"out": "/out"}},
+			"stepSub": api.Module{Imports: map[api.SlotName]api.ImportRef{
+				"x": api.ImportRef_Parent{"stepA", "wrong"},
+			}},
+		}}
+		_, err := ModuleOrderSteps(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrMissingOutput)
+		Wish(t, errcat.Details(err), ShouldEqual, map[string]string{
+			"step":   "stepSub",
+			"slot":   "stepA.wrong",
+			"reason": `parent import "parent:stepA.wrong" is invalid: step "stepA" has no output named "wrong"`,
+		})
+	})
+	t.Run("missing output within a submodule", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepSub": api.Module{Steps: map[api.StepName]api.StepUnion{
+				"stepX": api.Operation{},
+				"stepY": api.Operation{Inputs: map[api.AbsPath]api.SlotRef{"/": {"stepX", "out"}}},
+			}},
+		}}
+		_, err := ModuleOrderStepsDeep(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrMissingOutput)
+		Wish(t, err.(ReferenceError).Step, ShouldEqual, api.SubmoduleStepRef{"stepSub", "stepY"})
+	})
+	t.Run("ingest imports in submodules", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepSub": api.Module{Imports: map[api.SlotName]api.ImportRef{
+				"src": api.ImportRef_Ingest{"git", ".:HEAD"},
+			}},
+		}}
+		_, err := ModuleOrderSteps(basting)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidImport)
+		Wish(t, err.(ReferenceError).Slot, ShouldEqual, api.SlotRef{"", "src"})
+	})
+	t.Run("several ingest imports in submodules report the first by name", func(t *testing.T) {
+		basting := api.Module{Steps: map[api.StepName]api.StepUnion{
+			"stepSub": api.Module{Imports: map[api.SlotName]api.ImportRef{
+				"src-d": api.ImportRef_Ingest{"git", ".:HEAD"},
+				"src-b": api.ImportRef_Ingest{"git", ".:HEAD"},
+				"src-a": api.ImportRef_Ingest{"git", ".:HEAD"},
+				"src-c": api.ImportRef_Ingest{"git", ".:HEAD"},
+			}},
+		}}
+		for i := 0; i < 20; i++ {
+			_, err := ModuleOrderSteps(basting)
+			Wish(t, err.(ReferenceError).Slot, ShouldEqual, api.SlotRef{"", "src-a"})
+		}
+	})
+}
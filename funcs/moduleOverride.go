@@ -0,0 +1,112 @@
+package funcs
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/ingest"
+)
+
+// ImportOverride is a replacement for one import of a module:
+// either another ImportRef, or a WareID to use directly.
+// Exactly one of the two must be set.
+type ImportOverride struct {
+	Import api.ImportRef
+	WareID api.WareID
+}
+
+// importRef returns the ImportRef to use in place of the overridden import.
+// WareIDs become imports of kind ingest.IngestKind_Ware.
+func (o ImportOverride) importRef() (api.ImportRef, error) {
+	switch {
+	case o.Import != nil && o.WareID != (api.WareID{}):
+		return nil, fmt.Errorf("an override must give either an import or a wareID, not both")
+	case o.Import != nil:
+		if _, ok := o.Import.(api.ImportRef_Parent); ok {
+			return nil, fmt.Errorf("an override cannot be a parent import")
+		}
+		return o.Import, nil
+	case o.WareID.Type != "" && o.WareID.Hash != "":
+		return api.ImportRef_Ingest{IngestKind: ingest.IngestKind_Ware, Args: o.WareID.String()}, nil
+	default:
+		return nil, fmt.Errorf("an override must give either an import or a complete wareID")
+	}
+}
+
+// AppliedOverride records that an import of a module was overridden.
+type AppliedOverride struct {
+	Slot        api.SlotName
+	Original    api.ImportRef
+	Replacement api.ImportRef
+}
+
+// AppliedOverrides is the list of overrides applied by OverrideImports,
+// sorted by slot name.
+type AppliedOverrides []AppliedOverride
+
+/*
+	Metadata returns a description of the overrides suitable for attaching to
+	FormulaRunRecord.Metadata, so that the records of a run with overrides
+	say so.  There are two entries per override: "override.{slot}" gives the
+	replacement import, and "override.{slot}.original" the original.
+*/
+func (a AppliedOverrides) Metadata() map[string]string {
+	r := make(map[string]string, len(a)*2)
+	for _, o := range a {
+		r["override."+string(o.Slot)] = o.Replacement.String()
+		r["override."+string(o.Slot)+".original"] = o.Original.String()
+	}
+	return r
+}
+
+/*
+	OverrideImports returns a copy of the module with some of its root-level
+	imports replaced, along with a record of the overrides applied.
+
+	This is useful for trying out a candidate build of some dependency
+	against a module before it's released: e.g. overriding the import
+	"catalog:foo.org/lib:v1:src" with the WareID of the candidate.
+	Overrides by WareID become ingest imports of kind ingest.IngestKind_Ware,
+	so resolving the module's pins requires an IngestTool wrapped by
+	ingest.WithWareIngest.
+
+	Every overridden slot must already be an import of the module, or an
+	error of category ErrMissingImport is returned.  Invalid overrides
+	return an error of category ErrInvalidImport.
+*/
+func OverrideImports(m api.Module, overrides map[api.SlotName]ImportOverride) (api.Module, AppliedOverrides, error) {
+	slotNames := make([]api.SlotName, 0, len(overrides))
+	for slotName := range overrides {
+		slotNames = append(slotNames, slotName)
+	}
+	sort.Slice(slotNames, func(i, j int) bool { return slotNames[i] < slotNames[j] })
+
+	imports := make(map[api.SlotName]api.ImportRef, len(m.Imports))
+	for slotName, imp := range m.Imports {
+		imports[slotName] = imp
+	}
+	applied := make(AppliedOverrides, 0, len(overrides))
+	for _, slotName := range slotNames {
+		original, ok := m.Imports[slotName]
+		if !ok {
+			return api.Module{}, nil, errcat.ErrorDetailed(ErrMissingImport,
+				fmt.Sprintf("cannot override %q: it is not the name of an import in this module", slotName),
+				map[string]string{"slot": string(slotName)},
+			)
+		}
+		replacement, err := overrides[slotName].importRef()
+		if err != nil {
+			return api.Module{}, nil, errcat.ErrorDetailed(ErrInvalidImport,
+				fmt.Sprintf("cannot override %q: %s", slotName, err),
+				map[string]string{"slot": string(slotName)},
+			)
+		}
+		imports[slotName] = replacement
+		applied = append(applied, AppliedOverride{Slot: slotName, Original: original, Replacement: replacement})
+	}
+	m.Imports = imports
+	return m, applied, nil
+}
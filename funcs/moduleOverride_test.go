@@ -0,0 +1,98 @@
+package funcs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+	mockhitch "github.com/polydawn/go-timeless-api/hitch/mock"
+	"github.com/polydawn/go-timeless-api/ingest"
+)
+
+func TestOverrideImports(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+			"tool": ImportRef_Catalog{"example.org/tool", "v1", "linux-amd64"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepSub": Module{Imports: map[SlotName]ImportRef{
+				"tool": ImportRef_Catalog{"example.org/tool", "v2", "linux-amd64"},
+			}},
+		},
+	}
+	t.Run("overrides should be applied and recorded", func(t *testing.T) {
+		mod, applied, err := OverrideImports(module, map[SlotName]ImportOverride{
+			"tool": {WareID: WareID{"tar", "candidate"}},
+			"base": {Import: ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"}},
+		})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, mod.Imports, ShouldEqual, map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+			"tool": ImportRef_Ingest{"ware", "tar:candidate"},
+		})
+		Wish(t, applied.Metadata(), ShouldEqual, map[string]string{
+			"override.base":          "catalog:example.org/base:v2:linux-amd64",
+			"override.base.original": "catalog:example.org/base:v1:linux-amd64",
+			"override.tool":          "ingest:ware:tar:candidate",
+			"override.tool.original": "catalog:example.org/tool:v1:linux-amd64",
+		})
+		// The original module should be untouched.
+		Wish(t, module.Imports["tool"], ShouldEqual, ImportRef_Catalog{"example.org/tool", "v1", "linux-amd64"})
+	})
+	t.Run("ware overrides should resolve", func(t *testing.T) {
+		mod, _, err := OverrideImports(module, map[SlotName]ImportOverride{
+			"tool": {WareID: WareID{"tar", "candidate"}},
+		})
+		Wish(t, err, ShouldEqual, nil)
+		pins, _, err := ResolvePinsContext(context.Background(),
+			mod,
+			mockhitch.Fixture{
+				map[ModuleName]Lineage{
+					"example.org/base": Lineage{"example.org/base", []Release{
+						{Name: "v1", Items: map[ItemName]WareID{"linux-amd64": {"tar", "base1"}}},
+					}},
+					"example.org/tool": Lineage{"example.org/tool", []Release{
+						{Name: "v2", Items: map[ItemName]WareID{"linux-amd64": {"tar", "tool2"}}},
+					}},
+				},
+			}.ViewLineage,
+			func(_ context.Context, _ ModuleName) (*WareSourcing, error) {
+				return &WareSourcing{}, nil
+			},
+			ingest.WithWareIngest(func(_ context.Context, _ ImportRef_Ingest) (*WareID, *WareSourcing, error) {
+				return &WareID{"git", "f00f"}, &WareSourcing{}, nil
+			}),
+			0,
+		)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, pins, ShouldEqual, Pins{
+			{"", SlotRef{"", "base"}}:        {"tar", "base1"},
+			{"", SlotRef{"", "src"}}:         {"git", "f00f"},
+			{"", SlotRef{"", "tool"}}:        {"tar", "candidate"},
+			{"stepSub", SlotRef{"", "tool"}}: {"tar", "tool2"},
+		})
+	})
+	t.Run("missing slots are rejected", func(t *testing.T) {
+		_, _, err := OverrideImports(module, map[SlotName]ImportOverride{
+			"nope": {WareID: WareID{"tar", "candidate"}},
+		})
+		Wish(t, errcat.Category(err), ShouldEqual, ErrMissingImport)
+	})
+	t.Run("invalid overrides are rejected", func(t *testing.T) {
+		for _, o := range []ImportOverride{
+			{},
+			{WareID: WareID{"tar", ""}},
+			{Import: ImportRef_Parent{"", "x"}},
+			{Import: ImportRef_Ingest{"git", ".:HEAD"}, WareID: WareID{"tar", "candidate"}},
+		} {
+			_, _, err := OverrideImports(module, map[SlotName]ImportOverride{"tool": o})
+			Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidImport)
+		}
+	})
+}
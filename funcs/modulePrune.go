@@ -0,0 +1,98 @@
+package funcs
+
+import (
+	"fmt"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+/*
+	PruneModule returns a copy of the module with everything removed that
+	isn't needed to produce the wanted exports: steps (including steps inside
+	submodules), imports (including "parent:" imports of submodules),
+	and exports of submodules that nothing uses.  Exports of the root module
+	which aren't wanted are removed too.
+
+	If `want` is nil, all of the module's exports are wanted; evaluating the
+	pruned module then simply skips any steps that contribute to no export.
+
+	Errors are as for ModuleOrderStepsDeep, or ErrInvalidReference if one of
+	the wanted items isn't an export of the module.
+*/
+func PruneModule(m api.Module, want []api.ItemName) (api.Module, error) {
+	if _, err := ModuleOrderStepsDeep(m); err != nil {
+		return api.Module{}, err
+	}
+	wantSet := make(map[api.ItemName]struct{}, len(want))
+	if want == nil {
+		for itemName := range m.Exports {
+			wantSet[itemName] = struct{}{}
+		}
+	}
+	for _, itemName := range want {
+		if _, ok := m.Exports[itemName]; !ok {
+			return api.Module{}, errcat.ErrorDetailed(ErrInvalidReference,
+				fmt.Sprintf("cannot prune: module has no export named %q", itemName),
+				map[string]string{"ref": string(itemName)},
+			)
+		}
+		wantSet[itemName] = struct{}{}
+	}
+	return pruneModule(m, wantSet), nil
+}
+
+// pruneModule does the work of PruneModule, assuming the module's already been
+// checked.  It recurses into submodules as it finds which of their exports
+// are needed; the "parent:" imports each pruned submodule keeps tell us what
+// it needs in turn.
+func pruneModule(m api.Module, want map[api.ItemName]struct{}) api.Module {
+	r := api.Module{
+		Imports: map[api.SlotName]api.ImportRef{},
+		Steps:   map[api.StepName]api.StepUnion{},
+		Exports: map[api.ItemName]api.SlotRef{},
+	}
+	var todo []api.SlotRef
+	for itemName := range want {
+		r.Exports[itemName] = m.Exports[itemName]
+		todo = append(todo, m.Exports[itemName])
+	}
+	subWant := map[api.StepName]map[api.ItemName]struct{}{}
+	for len(todo) > 0 {
+		ref := todo[len(todo)-1]
+		todo = todo[:len(todo)-1]
+		if ref.StepName == "" {
+			r.Imports[ref.SlotName] = m.Imports[ref.SlotName]
+			continue
+		}
+		switch x := m.Steps[ref.StepName].(type) {
+		case api.Operation:
+			if _, ok := r.Steps[ref.StepName]; ok {
+				continue
+			}
+			r.Steps[ref.StepName] = x
+			for _, input := range x.Inputs {
+				todo = append(todo, input)
+			}
+		case api.Module:
+			if subWant[ref.StepName] == nil {
+				subWant[ref.StepName] = map[api.ItemName]struct{}{}
+			}
+			if _, ok := subWant[ref.StepName][api.ItemName(ref.SlotName)]; ok {
+				continue
+			}
+			subWant[ref.StepName][api.ItemName(ref.SlotName)] = struct{}{}
+			// Re-prune the submodule with its grown set of wanted exports.
+			//  (Wants only grow, so this terminates; redoing the whole submodule is simple and cheap enough.)
+			sub := pruneModule(x, subWant[ref.StepName])
+			r.Steps[ref.StepName] = sub
+			for _, imp := range sub.Imports {
+				if parentRef, ok := imp.(api.ImportRef_Parent); ok {
+					todo = append(todo, api.SlotRef(parentRef))
+				}
+			}
+		}
+	}
+	return r
+}
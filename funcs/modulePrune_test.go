@@ -0,0 +1,63 @@
+package funcs
+
+import (
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+)
+
+func TestPruneModule(t *testing.T) {
+	// The evaluation fixture, plus a "docs" step and export that the other
+	// exports don't need, an unused import, and a second step in submodule
+	// "stepB" (exported, and wired from "docs") that nothing else needs.
+	fixture := func() Module {
+		mod := fixtureEvaluationModule()
+		mod.Imports["unused"] = ImportRef_Catalog{"publishing.group/unused", "v1", "bin-linux-amd64"}
+		mod.Steps["docs"] = Operation{
+			Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}},
+			Action:  FormulaAction{Exec: []string{"docs"}},
+			Outputs: map[SlotName]AbsPath{"doc": "/doc"},
+		}
+		mod.Exports["docs"] = SlotRef{"docs", "doc"}
+		stepB := mod.Steps["stepB"].(Module)
+		stepB.Imports["y"] = ImportRef_Parent{"docs", "doc"}
+		stepB.Steps["op2"] = Operation{
+			Inputs:  map[AbsPath]SlotRef{"/": {"", "y"}},
+			Action:  FormulaAction{Exec: []string{"b2"}},
+			Outputs: map[SlotName]AbsPath{"out": "/out"},
+		}
+		stepB.Exports["bextra"] = SlotRef{"op2", "out"}
+		return mod
+	}
+	t.Run("prune to one export", func(t *testing.T) {
+		pruned, err := PruneModule(fixture(), []ItemName{"bin-linux-amd64"})
+		Wish(t, err, ShouldEqual, nil)
+		expect := fixtureEvaluationModule()
+		delete(expect.Exports, "src")
+		Wish(t, pruned, ShouldEqual, expect)
+	})
+	t.Run("prune to an export of an import", func(t *testing.T) {
+		pruned, err := PruneModule(fixture(), []ItemName{"src"})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, pruned, ShouldEqual, Module{
+			Imports: map[SlotName]ImportRef{"src": ImportRef_Ingest{"git", ".:HEAD"}},
+			Steps:   map[StepName]StepUnion{},
+			Exports: map[ItemName]SlotRef{"src": {"", "src"}},
+		})
+	})
+	t.Run("prune to all exports", func(t *testing.T) {
+		pruned, err := PruneModule(fixture(), nil)
+		Wish(t, err, ShouldEqual, nil)
+		expect := fixtureEvaluationModule()
+		expect.Steps["docs"] = fixture().Steps["docs"]
+		expect.Exports["docs"] = SlotRef{"docs", "doc"}
+		Wish(t, pruned, ShouldEqual, expect)
+	})
+	t.Run("unknown exports are rejected", func(t *testing.T) {
+		_, err := PruneModule(fixture(), []ItemName{"nope"})
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidReference)
+	})
+}
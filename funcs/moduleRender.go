@@ -0,0 +1,306 @@
+package funcs
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+/*
+	StepStatus describes how far evaluation of a step has got,
+	for the purpose of colouring it when rendering a module graph.
+*/
+type StepStatus string
+
+const (
+	StepStatus_Pending StepStatus = "pending" // No record yet.
+	StepStatus_Cached  StepStatus = "cached"  // A record was found in a memo store, so the step didn't need to run.
+	StepStatus_Ran     StepStatus = "ran"     // The step ran and exited zero.
+	StepStatus_Failed  StepStatus = "failed"  // The step ran and exited nonzero.
+)
+
+/*
+	ModuleStepStatuses computes a StepStatus for every Operation in the module
+	(recursively), given the records of those which have been evaluated so far
+	(as returned by EvaluateModule) and the set of those whose records came
+	from a cache rather than from running.
+*/
+func ModuleStepStatuses(
+	m api.Module,
+	records map[api.SubmoduleStepRef]api.OperationRecord,
+	cached map[api.SubmoduleStepRef]struct{},
+) (map[api.SubmoduleStepRef]StepStatus, error) {
+	all, err := ModuleOrderStepsDeep(m)
+	if err != nil {
+		return nil, err
+	}
+	r := make(map[api.SubmoduleStepRef]StepStatus, len(all))
+	for _, stepRef := range all {
+		if _, err := operationAt(m, stepRef); err != nil {
+			continue // submodules have no status of their own.
+		}
+		record, ok := records[stepRef]
+		_, isCached := cached[stepRef]
+		switch {
+		case !ok:
+			r[stepRef] = StepStatus_Pending
+		case record.ExitCode != 0:
+			r[stepRef] = StepStatus_Failed
+		case isCached:
+			r[stepRef] = StepStatus_Cached
+		default:
+			r[stepRef] = StepStatus_Ran
+		}
+	}
+	return r, nil
+}
+
+var stepStatusColors = map[StepStatus]string{
+	StepStatus_Pending: "#d3d3d3",
+	StepStatus_Cached:  "#add8e6",
+	StepStatus_Ran:     "#98fb98",
+	StepStatus_Failed:  "#fa8072",
+}
+
+/*
+	RenderModuleDot renders the module's graph of imports, steps, and exports
+	in the Graphviz DOT language.
+
+	Submodules are drawn as clusters.  Imports are labelled with their
+	ImportRef string; edges are labelled with the name of the slot they carry.
+	If `statuses` is non-nil, Operations are coloured by their status
+	(see ModuleStepStatuses).
+
+	The output is deterministic.  Errors are as for ModuleOrderSteps.
+*/
+func RenderModuleDot(m api.Module, statuses map[api.SubmoduleStepRef]StepStatus) (string, error) {
+	g, err := buildRenderGraph(m, statuses)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	b.WriteString("digraph module {\n")
+	b.WriteString("\trankdir=LR;\n")
+	var writeCluster func(cl *renderCluster, indent string)
+	writeCluster = func(cl *renderCluster, indent string) {
+		for _, n := range cl.nodes {
+			attrs := []string{"label=" + dotQuote(n.label)}
+			switch n.kind {
+			case renderNode_Import:
+				attrs = append(attrs, "shape=ellipse")
+			case renderNode_Step:
+				attrs = append(attrs, "shape=box")
+				if n.status != "" {
+					attrs = append(attrs, "style=filled", "fillcolor="+dotQuote(stepStatusColors[n.status]))
+				}
+			case renderNode_Export:
+				attrs = append(attrs, "shape=invhouse")
+			}
+			fmt.Fprintf(&b, "%s%s [%s];\n", indent, dotQuote(n.id), strings.Join(attrs, ", "))
+		}
+		for _, sub := range cl.clusters {
+			fmt.Fprintf(&b, "%ssubgraph %s {\n", indent, dotQuote("cluster_"+sub.id))
+			fmt.Fprintf(&b, "%s\tlabel=%s;\n", indent, dotQuote(sub.label))
+			writeCluster(sub, indent+"\t")
+			fmt.Fprintf(&b, "%s}\n", indent)
+		}
+	}
+	writeCluster(&g.root, "\t")
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "\t%s -> %s [label=%s];\n", dotQuote(e.from), dotQuote(e.to), dotQuote(e.label))
+	}
+	b.WriteString("}\n")
+	return b.String(), nil
+}
+
+/*
+	RenderModuleMermaid renders the module's graph of imports, steps, and
+	exports as a Mermaid flowchart.
+
+	It draws the same graph as RenderModuleDot, with the same conventions.
+	Node IDs are assigned sequentially, since Mermaid is picky about them;
+	the labels carry the names.
+*/
+func RenderModuleMermaid(m api.Module, statuses map[api.SubmoduleStepRef]StepStatus) (string, error) {
+	g, err := buildRenderGraph(m, statuses)
+	if err != nil {
+		return "", err
+	}
+	ids := map[string]string{}
+	mid := func(id string) string {
+		if _, ok := ids[id]; !ok {
+			ids[id] = fmt.Sprintf("n%d", len(ids))
+		}
+		return ids[id]
+	}
+	var b strings.Builder
+	b.WriteString("flowchart LR\n")
+	byStatus := map[StepStatus][]string{}
+	var writeCluster func(cl *renderCluster, indent string)
+	writeCluster = func(cl *renderCluster, indent string) {
+		for _, n := range cl.nodes {
+			switch n.kind {
+			case renderNode_Import:
+				fmt.Fprintf(&b, "%s%s([%s])\n", indent, mid(n.id), mermaidQuote(n.label))
+			case renderNode_Step:
+				fmt.Fprintf(&b, "%s%s[%s]\n", indent, mid(n.id), mermaidQuote(n.label))
+				if n.status != "" {
+					byStatus[n.status] = append(byStatus[n.status], mid(n.id))
+				}
+			case renderNode_Export:
+				fmt.Fprintf(&b, "%s%s[[%s]]\n", indent, mid(n.id), mermaidQuote(n.label))
+			}
+		}
+		for _, sub := range cl.clusters {
+			fmt.Fprintf(&b, "%ssubgraph %s [%s]\n", indent, mid("cluster:"+sub.id), mermaidQuote(sub.label))
+			writeCluster(sub, indent+"\t")
+			fmt.Fprintf(&b, "%send\n", indent)
+		}
+	}
+	writeCluster(&g.root, "\t")
+	for _, e := range g.edges {
+		fmt.Fprintf(&b, "\t%s -->|%s| %s\n", mid(e.from), mermaidQuote(e.label), mid(e.to))
+	}
+	for _, status := range []StepStatus{StepStatus_Pending, StepStatus_Cached, StepStatus_Ran, StepStatus_Failed} {
+		if len(byStatus[status]) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\tclassDef %s fill:%s\n", status, stepStatusColors[status])
+		fmt.Fprintf(&b, "\tclass %s %s\n", strings.Join(byStatus[status], ","), status)
+	}
+	return b.String(), nil
+}
+
+type renderNodeKind int
+
+const (
+	renderNode_Import renderNodeKind = iota
+	renderNode_Step
+	renderNode_Export
+)
+
+type renderNode struct {
+	id     string
+	label  string
+	kind   renderNodeKind
+	status StepStatus // only for steps; empty if not colouring.
+}
+
+type renderCluster struct {
+	id       string // the SubmoduleRef, for submodules; empty for the root.
+	label    string
+	nodes    []renderNode
+	clusters []*renderCluster
+}
+
+type renderEdge struct {
+	from, to string
+	label    string
+}
+
+// renderGraph is the format-independent form of the graph that
+// RenderModuleDot and RenderModuleMermaid both draw.
+type renderGraph struct {
+	root  renderCluster
+	edges []renderEdge
+}
+
+func buildRenderGraph(m api.Module, statuses map[api.SubmoduleStepRef]StepStatus) (*renderGraph, error) {
+	g := &renderGraph{}
+	if err := g.addModule(m, "", &g.root, statuses); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
+func renderImportID(ref api.SubmoduleSlotRef) string { return "import:" + ref.String() }
+func renderStepID(ref api.SubmoduleStepRef) string   { return "step:" + ref.String() }
+func renderExportID(at api.SubmoduleRef, itemName api.ItemName) string {
+	return "export:" + api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: api.SlotName(itemName)}}.String()
+}
+
+// renderSourceID returns the ID of the node a SlotRef in the module at `at` draws from.
+func renderSourceID(m api.Module, at api.SubmoduleRef, ref api.SlotRef) string {
+	if ref.StepName == "" {
+		return renderImportID(api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: ref})
+	}
+	if _, ok := m.Steps[ref.StepName].(api.Module); ok {
+		return renderExportID(at.Child(ref.StepName), api.ItemName(ref.SlotName))
+	}
+	return renderStepID(api.SubmoduleStepRef{SubmoduleRef: at, StepName: ref.StepName})
+}
+
+func (g *renderGraph) addModule(m api.Module, at api.SubmoduleRef, cl *renderCluster, statuses map[api.SubmoduleStepRef]StepStatus) error {
+	order, err := ModuleOrderSteps(m)
+	if err != nil {
+		return err
+	}
+
+	// Imports.  (Edges into "parent:" imports are drawn by our caller, since they come from the parent's nodes.)
+	for _, slotName := range sortedImportNames(m) {
+		ref := api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: slotName}}
+		cl.nodes = append(cl.nodes, renderNode{id: renderImportID(ref), label: m.Imports[slotName].String(), kind: renderNode_Import})
+	}
+
+	// Steps.
+	for _, stepName := range order {
+		stepRef := api.SubmoduleStepRef{SubmoduleRef: at, StepName: stepName}
+		switch x := m.Steps[stepName].(type) {
+		case api.Operation:
+			n := renderNode{id: renderStepID(stepRef), label: string(stepName), kind: renderNode_Step}
+			if statuses != nil {
+				n.status = statuses[stepRef]
+				if n.status == "" {
+					n.status = StepStatus_Pending
+				}
+			}
+			cl.nodes = append(cl.nodes, n)
+			paths := make([]api.AbsPath, 0, len(x.Inputs))
+			for p := range x.Inputs {
+				paths = append(paths, p)
+			}
+			api.SortMountOrder(paths)
+			for _, p := range paths {
+				slotRef := x.Inputs[p]
+				g.edges = append(g.edges, renderEdge{renderSourceID(m, at, slotRef), renderStepID(stepRef), string(slotRef.SlotName)})
+			}
+		case api.Module:
+			subAt := at.Child(stepName)
+			sub := &renderCluster{id: string(subAt), label: string(stepName)}
+			cl.clusters = append(cl.clusters, sub)
+			if err := g.addModule(x, subAt, sub, statuses); err != nil {
+				return contextualizeError(err, stepName)
+			}
+			for _, slotName := range sortedImportNames(x) {
+				if parentRef, ok := x.Imports[slotName].(api.ImportRef_Parent); ok {
+					to := renderImportID(api.SubmoduleSlotRef{SubmoduleRef: subAt, SlotRef: api.SlotRef{SlotName: slotName}})
+					g.edges = append(g.edges, renderEdge{renderSourceID(m, at, api.SlotRef(parentRef)), to, string(parentRef.SlotName)})
+				}
+			}
+		}
+	}
+
+	// Exports.
+	itemNames := make([]string, 0, len(m.Exports))
+	for itemName := range m.Exports {
+		itemNames = append(itemNames, string(itemName))
+	}
+	sort.Strings(itemNames)
+	for _, itemName := range itemNames {
+		slotRef := m.Exports[api.ItemName(itemName)]
+		id := renderExportID(at, api.ItemName(itemName))
+		cl.nodes = append(cl.nodes, renderNode{id: id, label: itemName, kind: renderNode_Export})
+		g.edges = append(g.edges, renderEdge{renderSourceID(m, at, slotRef), id, string(slotRef.SlotName)})
+	}
+	return nil
+}
+
+func dotQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s) + `"`
+}
+
+func mermaidQuote(s string) string {
+	return `"` + strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s) + `"`
+}
@@ -0,0 +1,149 @@
+package funcs
+
+import (
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+
+	. "github.com/polydawn/go-timeless-api"
+)
+
+func TestRenderModule(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+			"foo":  ImportRef_Ingest{"git", ".:HEAD"},
+			"bar":  ImportRef_Catalog{"publishing.group/bar", "v2.0", "bin-linux-amd64"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepA": Operation{
+				Inputs: map[AbsPath]SlotRef{
+					"/":    {"", "base"},
+					"/foo": {"", "foo"},
+					"/bar": {"", "bar"},
+				},
+				Action: FormulaAction{Exec: []string{"mv", "/foo/thinger", "/out/thinger"}},
+				Outputs: map[SlotName]AbsPath{
+					"intermediate": "/out",
+				},
+			},
+			"stepB": Module{
+				Imports: map[SlotName]ImportRef{
+					"base":   ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+					"bar":    ImportRef_Catalog{"publishing.group/bar", "v2.2", "bin-linux-amd64"}, // n.b. submodule uses different version of bar than parent; that's allowed.
+					"wodget": ImportRef_Parent{"stepA", "intermediate"},
+				},
+				Steps: map[StepName]StepUnion{
+					"op": Operation{
+						Inputs: map[AbsPath]SlotRef{
+							"/":    {"", "base"},
+							"/bar": {"", "bar"},
+							"/src": {"", "wodget"},
+						},
+						Action: FormulaAction{Exec: []string{"/bar/tool", "/src", "/out/thinger"}},
+						Outputs: map[SlotName]AbsPath{
+							"intermediate": "/out",
+						},
+					},
+				},
+				Exports: map[ItemName]SlotRef{"barred": {"op", "intermediate"}},
+			},
+			"stepC": Operation{
+				Inputs: map[AbsPath]SlotRef{
+					"/":    {"", "base"},
+					"/bar": {"stepB", "barred"},
+				},
+				Action: FormulaAction{Exec: []string{"/bar/thinger"}},
+				Outputs: map[SlotName]AbsPath{
+					"final": "/bar",
+				},
+			},
+		},
+		Exports: map[ItemName]SlotRef{
+			"src":             {"", "foo"},
+			"bin-linux-amd64": {"stepC", "final"},
+		},
+	}
+	statuses, err := ModuleStepStatuses(module,
+		map[SubmoduleStepRef]OperationRecord{
+			{"", "stepA"}:   {FormulaRunRecord: FormulaRunRecord{ExitCode: 0}},
+			{"stepB", "op"}: {FormulaRunRecord: FormulaRunRecord{ExitCode: 2}},
+		},
+		map[SubmoduleStepRef]struct{}{
+			{"", "stepA"}: {},
+		},
+	)
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, statuses, ShouldEqual, map[SubmoduleStepRef]StepStatus{
+		{"", "stepA"}:   StepStatus_Cached,
+		{"stepB", "op"}: StepStatus_Failed,
+		{"", "stepC"}:   StepStatus_Pending,
+	})
+	t.Run("dot", func(t *testing.T) {
+		s, err := RenderModuleDot(module, statuses)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, s, ShouldEqual, `digraph module {
+	rankdir=LR;
+	"import:bar" [label="catalog:publishing.group/bar:v2.0:bin-linux-amd64", shape=ellipse];
+	"import:base" [label="catalog:publishing.group/base:v2018:bin-linux-amd64", shape=ellipse];
+	"import:foo" [label="ingest:git:.:HEAD", shape=ellipse];
+	"step:stepA" [label="stepA", shape=box, style=filled, fillcolor="#add8e6"];
+	"step:stepC" [label="stepC", shape=box, style=filled, fillcolor="#d3d3d3"];
+	"export:bin-linux-amd64" [label="bin-linux-amd64", shape=invhouse];
+	"export:src" [label="src", shape=invhouse];
+	subgraph "cluster_stepB" {
+		label="stepB";
+		"import:stepB.bar" [label="catalog:publishing.group/bar:v2.2:bin-linux-amd64", shape=ellipse];
+		"import:stepB.base" [label="catalog:publishing.group/base:v2018:bin-linux-amd64", shape=ellipse];
+		"import:stepB.wodget" [label="parent:stepA.intermediate", shape=ellipse];
+		"step:stepB.op" [label="op", shape=box, style=filled, fillcolor="#fa8072"];
+		"export:stepB.barred" [label="barred", shape=invhouse];
+	}
+	"import:base" -> "step:stepA" [label="base"];
+	"import:bar" -> "step:stepA" [label="bar"];
+	"import:foo" -> "step:stepA" [label="foo"];
+	"import:stepB.base" -> "step:stepB.op" [label="base"];
+	"import:stepB.bar" -> "step:stepB.op" [label="bar"];
+	"import:stepB.wodget" -> "step:stepB.op" [label="wodget"];
+	"step:stepB.op" -> "export:stepB.barred" [label="intermediate"];
+	"step:stepA" -> "import:stepB.wodget" [label="intermediate"];
+	"import:base" -> "step:stepC" [label="base"];
+	"export:stepB.barred" -> "step:stepC" [label="barred"];
+	"step:stepC" -> "export:bin-linux-amd64" [label="final"];
+	"import:foo" -> "export:src" [label="foo"];
+}
+`)
+	})
+	t.Run("mermaid", func(t *testing.T) {
+		s, err := RenderModuleMermaid(module, nil)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, s, ShouldEqual, `flowchart LR
+	n0(["catalog:publishing.group/bar:v2.0:bin-linux-amd64"])
+	n1(["catalog:publishing.group/base:v2018:bin-linux-amd64"])
+	n2(["ingest:git:.:HEAD"])
+	n3["stepA"]
+	n4["stepC"]
+	n5[["bin-linux-amd64"]]
+	n6[["src"]]
+	subgraph n7 ["stepB"]
+		n8(["catalog:publishing.group/bar:v2.2:bin-linux-amd64"])
+		n9(["catalog:publishing.group/base:v2018:bin-linux-amd64"])
+		n10(["parent:stepA.intermediate"])
+		n11["op"]
+		n12[["barred"]]
+	end
+	n1 -->|"base"| n3
+	n0 -->|"bar"| n3
+	n2 -->|"foo"| n3
+	n9 -->|"base"| n11
+	n8 -->|"bar"| n11
+	n10 -->|"wodget"| n11
+	n11 -->|"intermediate"| n12
+	n3 -->|"intermediate"| n10
+	n1 -->|"base"| n4
+	n12 -->|"barred"| n4
+	n4 -->|"final"| n5
+	n2 -->|"foo"| n6
+`)
+	})
+}
@@ -2,6 +2,8 @@ package funcs
 
 import (
 	"context"
+	"sort"
+	"sync"
 
 	"github.com/warpfork/go-errcat"
 
@@ -28,43 +30,212 @@ func (t Pins) DetachSubtree(submoduleName api.StepName) Pins {
 	return t2
 }
 
+/*
+	PinnedImports returns every import in the module (recursively, including
+	all submodules) which gets a pin -- that is, every catalog and ingest
+	import -- keyed by SubmoduleSlotRef just as Pins are.
+	("parent:" imports refer to something else in the module, so they
+	aren't pinned, and aren't included.)
+*/
+func PinnedImports(m api.Module) map[api.SubmoduleSlotRef]api.ImportRef {
+	r := map[api.SubmoduleSlotRef]api.ImportRef{}
+	pinnedImports(m, "", r)
+	return r
+}
+
+func pinnedImports(m api.Module, at api.SubmoduleRef, into map[api.SubmoduleSlotRef]api.ImportRef) {
+	for slotName, impRef := range m.Imports {
+		switch impRef.(type) {
+		case api.ImportRef_Catalog, api.ImportRef_Ingest:
+			into[api.SubmoduleSlotRef{SubmoduleRef: at, SlotRef: api.SlotRef{SlotName: slotName}}] = impRef
+		}
+	}
+	for stepName, step := range m.Steps {
+		if x, ok := step.(api.Module); ok {
+			pinnedImports(x, at.Child(stepName), into)
+		}
+	}
+}
+
+// sortedImportRefs returns the keys of the map, sorted.
+func sortedImportRefs(imports map[api.SubmoduleSlotRef]api.ImportRef) []api.SubmoduleSlotRef {
+	r := make([]api.SubmoduleSlotRef, 0, len(imports))
+	for ref := range imports {
+		r = append(r, ref)
+	}
+	sort.Slice(r, func(i, j int) bool { return r[i].String() < r[j].String() })
+	return r
+}
+
+// catalogModuleNames returns the names of the modules the catalog imports refer to.
+func catalogModuleNames(imports map[api.SubmoduleSlotRef]api.ImportRef) map[api.ModuleName]struct{} {
+	r := map[api.ModuleName]struct{}{}
+	for _, impRef := range imports {
+		if impRef2, ok := impRef.(api.ImportRef_Catalog); ok {
+			r[impRef2.ModuleName] = struct{}{}
+		}
+	}
+	return r
+}
+
+/*
+	ResolvePins is ResolvePinsContext with a background context and no limit
+	on concurrent fetches.
+*/
 func ResolvePins(
 	m api.Module,
 	viewLineageTool hitch.ViewLineageTool,
 	viewWarehousesTool hitch.ViewWarehousesTool,
 	ingestTool ingest.IngestTool,
+) (Pins, *api.WareSourcing, error) {
+	return ResolvePinsContext(context.Background(), m, viewLineageTool, viewWarehousesTool, ingestTool, 0)
+}
+
+/*
+	ResolvePinsContext resolves every catalog and ingest import in the module
+	(recursively, including all submodules) to a WareID, and gathers the
+	WareSourcing for all of them.
+
+	Each distinct catalog module is looked up only once: all the ModuleNames
+	used anywhere in the module are gathered first, and their lineages and
+	warehouses are fetched concurrently, with at most `limit` fetches in
+	flight at once (a limit of zero or less means no limit).  If any fetch
+	fails, the others are cancelled, and the first error is returned.
+	If the context is cancelled, the error is of category hitch.ErrCancelled.
+	Ingest imports are resolved after all the fetches, one at a time.
+
+	A module with no lineage is an error, but a module with no warehouses
+	is not (the WareSourcing simply doesn't gain anything).
+*/
+func ResolvePinsContext(
+	ctx context.Context,
+	m api.Module,
+	viewLineageTool hitch.ViewLineageTool,
+	viewWarehousesTool hitch.ViewWarehousesTool,
+	ingestTool ingest.IngestTool,
+	limit int,
+) (Pins, *api.WareSourcing, error) {
+	cache, err := fetchCatalogs(ctx, catalogModuleNames(PinnedImports(m)), viewLineageTool, viewWarehousesTool, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resolvePins(ctx, m, cache, ingestTool)
+}
+
+// catalogCacheEntry holds the results of ViewLineageTool and ViewWarehousesTool for one module.
+type catalogCacheEntry struct {
+	lineage api.Lineage
+	ws      api.WareSourcing
+}
+
+func fetchCatalogs(
+	ctx context.Context,
+	moduleNames map[api.ModuleName]struct{},
+	viewLineageTool hitch.ViewLineageTool,
+	viewWarehousesTool hitch.ViewWarehousesTool,
+	limit int,
+) (map[api.ModuleName]catalogCacheEntry, error) {
+	if limit <= 0 {
+		limit = len(moduleNames)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		cache    = make(map[api.ModuleName]catalogCacheEntry, len(moduleNames))
+		firstErr error
+		sem      = make(chan struct{}, limit)
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel()
+		}
+	}
+	for modName := range moduleNames {
+		wg.Add(1)
+		go func(modName api.ModuleName) {
+			defer wg.Done()
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+			}
+			if err := ctx.Err(); err != nil {
+				fail(errcat.Errorf(hitch.ErrCancelled, "pin resolution cancelled: %s", err))
+				return
+			}
+			entry, err := fetchCatalog(ctx, modName, viewLineageTool, viewWarehousesTool)
+			if err != nil {
+				fail(err)
+				return
+			}
+			mu.Lock()
+			cache[modName] = *entry
+			mu.Unlock()
+		}(modName)
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return cache, nil
+}
+
+// fetchCatalog fetches the lineage and warehouses of a module.
+// If viewWarehousesTool is nil, only the lineage is fetched.
+func fetchCatalog(
+	ctx context.Context,
+	modName api.ModuleName,
+	viewLineageTool hitch.ViewLineageTool,
+	viewWarehousesTool hitch.ViewWarehousesTool,
+) (*catalogCacheEntry, error) {
+	mcat, err := viewLineageTool(ctx, modName)
+	if err != nil {
+		return nil, err
+	}
+	if viewWarehousesTool == nil {
+		return &catalogCacheEntry{lineage: *mcat}, nil
+	}
+	modWs, err := viewWarehousesTool(ctx, modName)
+	if err != nil {
+		switch errcat.Category(err) {
+		case hitch.ErrNoSuchLineage:
+			modWs = &api.WareSourcing{}
+		default:
+			return nil, err
+		}
+	}
+	return &catalogCacheEntry{lineage: *mcat, ws: *modWs}, nil
+}
+
+func resolvePins(
+	ctx context.Context,
+	m api.Module,
+	cache map[api.ModuleName]catalogCacheEntry,
+	ingestTool ingest.IngestTool,
 ) (Pins, *api.WareSourcing, error) {
 	r := make(Pins)
 	ws := api.WareSourcing{}
 
 	// resolve each of our imports in this module
 	for slotName, impRef := range m.Imports {
-		_, _ = slotName, impRef
 		switch impRef2 := impRef.(type) {
 		case api.ImportRef_Catalog:
-			mcat, err := viewLineageTool(context.TODO(), impRef2.ModuleName)
-			if err != nil {
-				return nil, nil, err
-			}
-			wareID, err := hitch.LineagePluckReleaseItem(*mcat, impRef2.ReleaseName, impRef2.ItemName)
+			entry := cache[impRef2.ModuleName]
+			wareID, err := hitch.LineagePluckReleaseItem(entry.lineage, impRef2.ReleaseName, impRef2.ItemName)
 			if err != nil {
 				return nil, nil, err
 			}
 			r[api.SubmoduleSlotRef{"", api.SlotRef{"", slotName}}] = *wareID
-			modWs, err := viewWarehousesTool(context.TODO(), impRef2.ModuleName)
-			if err != nil {
-				switch errcat.Category(err) {
-				case hitch.ErrNoSuchLineage:
-					modWs = &api.WareSourcing{}
-				default:
-					return nil, nil, err
-				}
-			}
-			ws.Append(modWs.PivotToModuleWare(*wareID, impRef2.ModuleName))
+			ws.Append(entry.ws.PivotToModuleWare(*wareID, impRef2.ModuleName))
 		case api.ImportRef_Parent:
 			// pass.  we don't resolve these in advance; and it's checked by the 'OrderSteps' func that this refers to *something*.
 		case api.ImportRef_Ingest:
-			wareID, wareSourcing, err := ingestTool(context.TODO(), impRef2)
+			wareID, wareSourcing, err := ingestTool(ctx, impRef2)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -80,7 +251,7 @@ func ResolvePins(
 			// pass.  hakuna matata; operations only have local references to their module's imports.
 		case api.Module:
 			// recurse, and contextualize all refs from the deeper module(s).
-			subPins, wareSourcing, err := ResolvePins(x, viewLineageTool, viewWarehousesTool, nil)
+			subPins, wareSourcing, err := resolvePins(ctx, x, cache, nil)
 			if err != nil {
 				return nil, nil, err
 			}
@@ -2,11 +2,15 @@ package funcs
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"testing"
 
+	"github.com/warpfork/go-errcat"
 	. "github.com/warpfork/go-wish"
 
 	. "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/hitch"
 	mockhitch "github.com/polydawn/go-timeless-api/hitch/mock"
 )
 
@@ -104,3 +108,108 @@ func TestPinning(t *testing.T) {
 		{"stepB", SlotRef{"", "bar"}}:  {"tar", "qwer2"},
 	})
 }
+
+func TestPinningContext(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepSub": Module{
+				Imports: map[SlotName]ImportRef{
+					"base": ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+					"tool": ImportRef_Catalog{"example.org/tool", "v1", "linux-amd64"},
+					"src":  ImportRef_Parent{"", "src"},
+				},
+				Steps: map[StepName]StepUnion{
+					"op": Operation{
+						Inputs: map[AbsPath]SlotRef{
+							"/":     {"", "base"},
+							"/tool": {"", "tool"},
+							"/src":  {"", "src"},
+						},
+						Action:  FormulaAction{Exec: []string{"/tool/build", "/src"}},
+						Outputs: map[SlotName]AbsPath{"out": "/out"},
+					},
+				},
+				Exports: map[ItemName]SlotRef{"out": {"op", "out"}},
+			},
+		},
+	}
+	catalog := mockhitch.Fixture{
+		map[ModuleName]Lineage{
+			"example.org/base": Lineage{"example.org/base", []Release{
+				{Name: "v1", Items: map[ItemName]WareID{"linux-amd64": {"tar", "base1"}}},
+				{Name: "v2", Items: map[ItemName]WareID{"linux-amd64": {"tar", "base2"}}},
+			}},
+			"example.org/tool": Lineage{"example.org/tool", []Release{
+				{Name: "v1", Items: map[ItemName]WareID{"linux-amd64": {"tar", "tool1"}}},
+			}},
+		},
+	}
+	viewWarehouses := func(_ context.Context, _ ModuleName) (*WareSourcing, error) {
+		return &WareSourcing{}, nil
+	}
+	ingest := func(_ context.Context, _ ImportRef_Ingest) (*WareID, *WareSourcing, error) {
+		return &WareID{"git", "f00f"}, &WareSourcing{}, nil
+	}
+
+	var mu sync.Mutex
+	calls := map[ModuleName]int{}
+	counting := func(ctx context.Context, modName ModuleName) (*Lineage, error) {
+		mu.Lock()
+		calls[modName]++
+		mu.Unlock()
+		return catalog.ViewLineage(ctx, modName)
+	}
+	for _, limit := range []int{0, 1, 4} {
+		t.Run(fmt.Sprintf("limit %d", limit), func(t *testing.T) {
+			calls = map[ModuleName]int{}
+			pins, _, err := ResolvePinsContext(context.Background(), module, counting, viewWarehouses, ingest, limit)
+			Wish(t, err, ShouldEqual, nil)
+			Wish(t, pins, ShouldEqual, Pins{
+				{"", SlotRef{"", "base"}}:        {"tar", "base1"},
+				{"", SlotRef{"", "src"}}:         {"git", "f00f"},
+				{"stepSub", SlotRef{"", "base"}}: {"tar", "base2"},
+				{"stepSub", SlotRef{"", "tool"}}: {"tar", "tool1"},
+			})
+			Wish(t, calls, ShouldEqual, map[ModuleName]int{
+				"example.org/base": 1,
+				"example.org/tool": 1,
+			})
+		})
+	}
+	t.Run("missing lineage", func(t *testing.T) {
+		_, _, err := ResolvePinsContext(context.Background(), module, mockhitch.Fixture{}.ViewLineage, viewWarehouses, ingest, 2)
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrNoSuchLineage)
+	})
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, _, err := ResolvePinsContext(ctx, module, catalog.ViewLineage, viewWarehouses, ingest, 1)
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrCancelled)
+	})
+}
+
+func TestPinnedImports(t *testing.T) {
+	module := Module{
+		Imports: map[SlotName]ImportRef{
+			"base": ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[StepName]StepUnion{
+			"stepSub": Module{
+				Imports: map[SlotName]ImportRef{
+					"base": ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+					"src":  ImportRef_Parent{"", "src"},
+				},
+			},
+		},
+	}
+	Wish(t, PinnedImports(module), ShouldEqual, map[SubmoduleSlotRef]ImportRef{
+		{"", SlotRef{"", "base"}}:        ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+		{"", SlotRef{"", "src"}}:         ImportRef_Ingest{"git", ".:HEAD"},
+		{"stepSub", SlotRef{"", "base"}}: ImportRef_Catalog{"example.org/base", "v2", "linux-amd64"},
+	})
+}
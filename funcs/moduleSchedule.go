@@ -0,0 +1,174 @@
+package funcs
+
+import (
+	"context"
+	"sort"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/repeatr"
+)
+
+/*
+	ScheduleSteps calls `stepFn` once for every Operation in the module
+	(recursively including all submodules), starting each one as soon as
+	all of the Operations producing its inputs have completed, and running
+	up to `workers` of them at once.  (A `workers` value less than one is
+	treated as one.)
+
+	When more Operations are ready than there are free workers, they're
+	started in the order given by ModuleOrderStepsDeep -- so the lexical
+	tie-breaking rules of ModuleOrderSteps still determine priority,
+	and with a single worker the order is exactly that of ModuleOrderStepsDeep.
+
+	If any `stepFn` returns an error, or the context is cancelled, no further
+	steps are started; the context given to in-flight steps is cancelled,
+	and ScheduleSteps waits for them to return before returning the first
+	error encountered.  Cancellation of the parent context is reported as
+	repeatr.ErrCancelled.
+*/
+func ScheduleSteps(
+	ctx context.Context,
+	m api.Module,
+	workers int,
+	stepFn func(context.Context, api.SubmoduleStepRef) error,
+) error {
+	if workers < 1 {
+		workers = 1
+	}
+	order, deps, err := operationDeps(m)
+	if err != nil {
+		return err
+	}
+
+	// Index priorities and build the reverse edges.
+	priority := make(map[api.SubmoduleStepRef]int, len(order))
+	waiting := make(map[api.SubmoduleStepRef]int, len(order))
+	dependents := make(map[api.SubmoduleStepRef][]api.SubmoduleStepRef, len(order))
+	ready := stepQueue{priority: priority}
+	for i, stepRef := range order {
+		priority[stepRef] = i
+		waiting[stepRef] = len(deps[stepRef])
+		for _, dep := range deps[stepRef] {
+			dependents[dep] = append(dependents[dep], stepRef)
+		}
+		if len(deps[stepRef]) == 0 {
+			ready.steps = append(ready.steps, stepRef)
+		}
+	}
+
+	// Dispatch loop.
+	//  Only this goroutine touches the bookkeeping; workers just report back.
+	stepCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		stepRef api.SubmoduleStepRef
+		err     error
+	}
+	results := make(chan result)
+	running := 0
+	var firstErr error
+	for {
+		for running < workers && len(ready.steps) > 0 && firstErr == nil {
+			if ctx.Err() != nil {
+				break
+			}
+			stepRef := ready.pop()
+			running++
+			go func() {
+				results <- result{stepRef, stepFn(stepCtx, stepRef)}
+			}()
+		}
+		if running == 0 {
+			// In-flight steps may have failed because of the cancellation;
+			// report the cancellation rather than whatever they returned.
+			if err := ctx.Err(); err != nil {
+				return errcat.Errorf(repeatr.ErrCancelled, "evaluation cancelled: %s", err)
+			}
+			return firstErr
+		}
+		res := <-results
+		running--
+		if res.err != nil {
+			if firstErr == nil {
+				firstErr = res.err
+				cancel()
+			}
+			continue
+		}
+		for _, dependent := range dependents[res.stepRef] {
+			waiting[dependent]--
+			if waiting[dependent] == 0 {
+				ready.push(dependent)
+			}
+		}
+	}
+}
+
+// stepQueue holds steps ready to run, popping them in priority order.
+type stepQueue struct {
+	steps    []api.SubmoduleStepRef
+	priority map[api.SubmoduleStepRef]int
+}
+
+func (q *stepQueue) push(stepRef api.SubmoduleStepRef) {
+	i := sort.Search(len(q.steps), func(i int) bool { return q.priority[q.steps[i]] > q.priority[stepRef] })
+	q.steps = append(q.steps, api.SubmoduleStepRef{})
+	copy(q.steps[i+1:], q.steps[i:])
+	q.steps[i] = stepRef
+}
+
+func (q *stepQueue) pop() api.SubmoduleStepRef {
+	stepRef := q.steps[0]
+	q.steps = q.steps[1:]
+	return stepRef
+}
+
+/*
+	operationDeps returns all the Operations in the module (recursively
+	including all submodules) in the order given by ModuleOrderStepsDeep,
+	and for each of them, the set of other Operations which produce its
+	inputs (following submodule exports and parent imports as necessary;
+	see traceSlotRef).  Inputs that come from pinned imports are no
+	dependency at all.
+
+	The dependency lists are deduplicated and in priority order.
+*/
+func operationDeps(m api.Module) (StepTree, map[api.SubmoduleStepRef][]api.SubmoduleStepRef, error) {
+	all, err := ModuleOrderStepsDeep(m)
+	if err != nil {
+		return nil, nil, err
+	}
+	var order StepTree
+	priority := make(map[api.SubmoduleStepRef]int, len(all))
+	deps := make(map[api.SubmoduleStepRef][]api.SubmoduleStepRef, len(all))
+	for _, stepRef := range all {
+		op, err := operationAt(m, stepRef)
+		if err != nil {
+			continue // submodules themselves don't run; only their steps do.
+		}
+		priority[stepRef] = len(order)
+		order = append(order, stepRef)
+		seen := map[api.SubmoduleStepRef]struct{}{}
+		for _, slotRef := range op.Inputs {
+			src, err := traceSlotRef(m, api.SubmoduleSlotRef{SubmoduleRef: stepRef.SubmoduleRef, SlotRef: slotRef})
+			if err != nil {
+				return nil, nil, errcat.AppendDetail(err, "step", stepRef.String())
+			}
+			if src.StepName == "" {
+				continue
+			}
+			dep := api.SubmoduleStepRef{SubmoduleRef: src.SubmoduleRef, StepName: src.StepName}
+			if _, ok := seen[dep]; ok {
+				continue
+			}
+			seen[dep] = struct{}{}
+			deps[stepRef] = append(deps[stepRef], dep)
+		}
+		sort.Slice(deps[stepRef], func(i, j int) bool {
+			return priority[deps[stepRef][i]] < priority[deps[stepRef][j]]
+		})
+	}
+	return order, deps, nil
+}
@@ -0,0 +1,214 @@
+package funcs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/repeatr"
+)
+
+func TestScheduleSingleWorker(t *testing.T) {
+	var order StepTree
+	err := ScheduleSteps(context.Background(), fixtureComplexOrderingModule(), 1, func(_ context.Context, stepRef api.SubmoduleStepRef) error {
+		order = append(order, stepRef)
+		return nil
+	})
+	Wish(t, err, ShouldEqual, nil)
+	expect, _ := ModuleOrderStepsDeep(fixtureComplexOrderingModule())
+	Wish(t, order, ShouldEqual, expect)
+}
+
+func TestScheduleRespectsDependencies(t *testing.T) {
+	module := fixtureComplexOrderingModule()
+	_, deps, err := operationDeps(module)
+	Wish(t, err, ShouldEqual, nil)
+	var mu sync.Mutex
+	done := map[api.SubmoduleStepRef]bool{}
+	var violations []string
+	err = ScheduleSteps(context.Background(), module, 4, func(_ context.Context, stepRef api.SubmoduleStepRef) error {
+		mu.Lock()
+		for _, dep := range deps[stepRef] {
+			if !done[dep] {
+				violations = append(violations, fmt.Sprintf("%s started before %s", stepRef, dep))
+			}
+		}
+		mu.Unlock()
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		done[stepRef] = true
+		mu.Unlock()
+		return nil
+	})
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, violations, ShouldEqual, []string(nil))
+	Wish(t, len(done), ShouldEqual, 13)
+}
+
+func TestScheduleRunsFanoutConcurrently(t *testing.T) {
+	// Steps F's three dependents (G, I, J) can only all get past this barrier
+	//  if they're all running at the same time.
+	var barrier sync.WaitGroup
+	barrier.Add(3)
+	err := ScheduleSteps(context.Background(), fixtureComplexOrderingModule(), 3, func(_ context.Context, stepRef api.SubmoduleStepRef) error {
+		switch stepRef.StepName {
+		case "stepG", "stepI", "stepJ":
+			barrier.Done()
+			waited := make(chan struct{})
+			go func() { barrier.Wait(); close(waited) }()
+			select {
+			case <-waited:
+			case <-time.After(5 * time.Second):
+				return fmt.Errorf("%s was never running alongside its siblings", stepRef)
+			}
+		}
+		return nil
+	})
+	Wish(t, err, ShouldEqual, nil)
+}
+
+func TestScheduleHaltsOnError(t *testing.T) {
+	var mu sync.Mutex
+	var ran []api.StepName
+	err := ScheduleSteps(context.Background(), fixtureComplexOrderingModule(), 1, func(_ context.Context, stepRef api.SubmoduleStepRef) error {
+		mu.Lock()
+		ran = append(ran, stepRef.StepName)
+		mu.Unlock()
+		if stepRef.StepName == "stepD" {
+			return errcat.Errorf(ErrStepFailed, "no")
+		}
+		return nil
+	})
+	Wish(t, errcat.Category(err), ShouldEqual, ErrStepFailed)
+	Wish(t, ran, ShouldEqual, []api.StepName{"stepA", "stepB", "stepC", "stepD"})
+}
+
+func TestScheduleCancellation(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var ran []api.StepName
+	err := ScheduleSteps(ctx, fixtureComplexOrderingModule(), 1, func(_ context.Context, stepRef api.SubmoduleStepRef) error {
+		ran = append(ran, stepRef.StepName)
+		if stepRef.StepName == "stepB" {
+			cancel()
+		}
+		return nil
+	})
+	Wish(t, errcat.Category(err), ShouldEqual, repeatr.ErrCancelled)
+	Wish(t, ran, ShouldEqual, []api.StepName{"stepA", "stepB"})
+}
+
+func TestScheduleCancellationWhileRunning(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	started := make(chan struct{})
+	go func() {
+		<-started
+		cancel()
+	}()
+	err := ScheduleSteps(ctx, fixtureComplexOrderingModule(), 2, func(ctx context.Context, stepRef api.SubmoduleStepRef) error {
+		if stepRef.StepName == "stepA" {
+			close(started)
+		}
+		<-ctx.Done()
+		return fmt.Errorf("step %s interrupted: %s", stepRef, ctx.Err())
+	})
+	Wish(t, errcat.Category(err), ShouldEqual, repeatr.ErrCancelled)
+}
+
+// fixtureComplexOrderingModule is the same module as TestComplexOrdering uses.
+func fixtureComplexOrderingModule() api.Module {
+	/*
+	               /------------> K --\
+	               |                   \
+	  A --> B -----E ------> H --------> L
+	              /                     /
+	    C --> D -----F --> G ----------/
+	                 |
+	                 \------> I----------> M
+	                 |                    /
+	                 \--------> J -------/
+	*/
+	return api.Module{Steps: map[api.StepName]api.StepUnion{
+		"stepA": api.Operation{
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepB": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepA", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepC": api.Operation{
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepD": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepC", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepE": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/":  {"stepB", "slot"},
+				"/1": {"stepD", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepF": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepD", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepG": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepF", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepH": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepE", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepI": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepF", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepJ": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepF", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepK": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/": {"stepE", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepL": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/":  {"stepG", "slot"},
+				"/1": {"stepK", "slot"},
+				"/2": {"stepH", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+		"stepM": api.Operation{
+			Inputs: map[api.AbsPath]api.SlotRef{
+				"/":  {"stepI", "slot"},
+				"/1": {"stepJ", "slot"},
+			},
+			Outputs: map[api.SlotName]api.AbsPath{"slot": "/"},
+		},
+	}}
+}
@@ -1,5 +1,15 @@
 package funcs
 
+import (
+	api "github.com/polydawn/go-timeless-api"
+)
+
+var (
+	_ Validatable = api.Module{}
+	_ Validatable = api.Formula{}
+	_ Validatable = api.FormulaAction{}
+)
+
 // Validatable is an interface types may implement in order to return validation
 // errors in a conventional way.
 type Validatable interface {
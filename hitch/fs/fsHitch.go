@@ -0,0 +1,142 @@
+package fshitch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	"github.com/polydawn/refmt/obj/atlas"
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/hitch"
+)
+
+var (
+	_ hitch.ViewLineageTool    = Catalog{}.ViewLineage
+	_ hitch.ViewWarehousesTool = Catalog{}.ViewWarehouses
+)
+
+const (
+	LineageFilename = "lineage.json"
+	MirrorsFilename = "mirrors.json"
+)
+
+/*
+	Catalog is a catalog kept in a directory on the local filesystem,
+	in the same layout the hitch CLI uses.
+
+	Each module has a directory, at "{Root}/{moduleName}" (module names may
+	contain slashes, so this may be several directories deep).  In it,
+	"lineage.json" holds the module's Lineage, and "mirrors.json" (which is
+	optional) holds the WareSourcing for its wares.  Publishers also keep a
+	lock file there; see PublishRelease.
+
+	ModuleName.Validate ensures module names can't escape the root, but
+	path segments may contain dots, so a module named e.g.
+	"example.org/foo/lineage.json" would have its directory where module
+	"example.org/foo" keeps its lineage.  Module names with a path segment
+	of "lineage.json" or "mirrors.json" are therefore rejected.
+*/
+type Catalog struct {
+	Root string
+}
+
+// ViewLineage returns the lineage of a module.
+//
+// Errors will be of category hitch.ErrNoSuchLineage if the module has no
+// lineage in the catalog, hitch.ErrCorruptState if it can't be parsed,
+// hitch.ErrUsage if the module name is invalid, or hitch.ErrStorage.
+func (c Catalog) ViewLineage(_ context.Context, modName api.ModuleName) (*api.Lineage, error) {
+	dir, err := c.moduleDir(modName)
+	if err != nil {
+		return nil, err
+	}
+	var lin api.Lineage
+	if err := readFile(filepath.Join(dir, LineageFilename), &lin, api.Atlas_Catalog); err != nil {
+		if os.IsNotExist(err) {
+			return nil, errcat.ErrorDetailed(hitch.ErrNoSuchLineage,
+				fmt.Sprintf("no lineage for module %q", modName),
+				map[string]string{"ref": string(modName)},
+			)
+		}
+		return nil, errcat.AppendDetail(err, "ref", string(modName))
+	}
+	if lin.Name != modName {
+		return nil, errcat.ErrorDetailed(hitch.ErrCorruptState,
+			fmt.Sprintf("lineage for module %q is named %q", modName, lin.Name),
+			map[string]string{"ref": string(modName)},
+		)
+	}
+	return &lin, nil
+}
+
+// ViewWarehouses returns the ware sourcing info for a module.
+// If the module has a lineage but no mirrors file, the result is empty.
+//
+// Errors are as for ViewLineage.
+func (c Catalog) ViewWarehouses(_ context.Context, modName api.ModuleName) (*api.WareSourcing, error) {
+	dir, err := c.moduleDir(modName)
+	if err != nil {
+		return nil, err
+	}
+	var ws api.WareSourcing
+	if err := readFile(filepath.Join(dir, MirrorsFilename), &ws, api.Atlas_WareSourcing); err != nil {
+		if !os.IsNotExist(err) {
+			return nil, errcat.AppendDetail(err, "ref", string(modName))
+		}
+		if _, err := os.Stat(filepath.Join(dir, LineageFilename)); err != nil {
+			return nil, errcat.ErrorDetailed(hitch.ErrNoSuchLineage,
+				fmt.Sprintf("no lineage for module %q", modName),
+				map[string]string{"ref": string(modName)},
+			)
+		}
+	}
+	return &ws, nil
+}
+
+// moduleDir returns the directory for a module, or an error of category
+// hitch.ErrUsage if the module name is invalid (or would collide with
+// another module's files).
+func (c Catalog) moduleDir(modName api.ModuleName) (string, error) {
+	if err := modName.Validate(); err != nil {
+		return "", errcat.ErrorDetailed(hitch.ErrUsage,
+			fmt.Sprintf("invalid module name %q: %s", modName, err),
+			map[string]string{"ref": string(modName)},
+		)
+	}
+	for _, hunk := range strings.Split(string(modName), "/")[1:] {
+		switch hunk {
+		case LineageFilename, MirrorsFilename:
+			return "", errcat.ErrorDetailed(hitch.ErrUsage,
+				fmt.Sprintf("invalid module name %q: path segment %q is reserved for catalog files", modName, hunk),
+				map[string]string{"ref": string(modName)},
+			)
+		}
+	}
+	return filepath.Join(c.Root, filepath.FromSlash(string(modName))), nil
+}
+
+// readFile reads and parses a JSON file.
+// If the file doesn't exist, the os error is returned as-is (so
+// os.IsNotExist works on it); otherwise errors are of category
+// hitch.ErrStorage or hitch.ErrCorruptState.
+func readFile(path string, into interface{}, atl atlas.Atlas) error {
+	bs, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		// continue!
+	case os.IsNotExist(err):
+		return err
+	default:
+		return errcat.Errorf(hitch.ErrStorage, "cannot read %q: %s", path, err)
+	}
+	if err := refmt.UnmarshalAtlased(json.DecodeOptions{}, bs, into, atl); err != nil {
+		return errcat.Errorf(hitch.ErrCorruptState, "cannot parse %q: %s", path, err)
+	}
+	return nil
+}
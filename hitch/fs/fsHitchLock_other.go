@@ -0,0 +1,40 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly
+
+package fshitch
+
+import (
+	"context"
+	"os"
+	"time"
+)
+
+// lockFile takes an exclusive lock by creating the file at the given path,
+// waiting until it's available or the context is done.
+// The returned func releases the lock (by removing the file).
+//
+// This is the fallback for platforms without flock.  Unlike flock,
+// a lock file left behind by a crashed process must be removed by hand.
+func lockFile(ctx context.Context, path string) (func(), error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// syncDir is a no-op on platforms without flock: not all of them can fsync
+// a directory (Windows can't open one for writing).
+func syncDir(path string) error {
+	return nil
+}
@@ -0,0 +1,118 @@
+package fshitch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/hitch"
+)
+
+// LockFilename is the name of the file, in each module's directory, which
+// publishers lock while they update the module's lineage.
+const LockFilename = ".lock"
+
+const lockPollInterval = 10 * time.Millisecond
+
+/*
+	PublishRelease adds a new release to the top of a module's lineage
+	(as by hitch.LineagePrependRelease), creating the lineage if the module
+	doesn't have one yet.  The updated lineage is returned.
+
+	Publishing is safe against concurrent publishers, in this process or any
+	other: the module's lock file is held while the lineage is read and
+	rewritten, so no release is ever lost to a race.  The new lineage is
+	written to a temporary file and renamed into place, so readers (which
+	don't lock) never see a partially written lineage.
+
+	Errors will be of category hitch.ErrNameCollision if the lineage already
+	has a release of the same name, hitch.ErrUsage if the module or release
+	name is invalid, or as for ViewLineage.  If the context is cancelled while
+	waiting for the lock, an error of category hitch.ErrCancelled is returned.
+*/
+func (c Catalog) PublishRelease(ctx context.Context, modName api.ModuleName, rel api.Release) (*api.Lineage, error) {
+	dir, err := c.moduleDir(modName)
+	if err != nil {
+		return nil, err
+	}
+	if rel.Name == "" {
+		return nil, errcat.ErrorDetailed(hitch.ErrUsage,
+			"cannot publish a release with no name",
+			map[string]string{"ref": string(modName)},
+		)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errcat.Errorf(hitch.ErrStorage, "cannot publish release: %s", err)
+	}
+	unlock, err := lockFile(ctx, filepath.Join(dir, LockFilename))
+	switch {
+	case err == nil:
+		// continue!
+	case err == ctx.Err():
+		return nil, errcat.Errorf(hitch.ErrCancelled, "publish cancelled: %s", err)
+	default:
+		return nil, errcat.Errorf(hitch.ErrStorage, "cannot lock module %q: %s", modName, err)
+	}
+	defer unlock()
+
+	lin, err := c.ViewLineage(ctx, modName)
+	switch errcat.Category(err) {
+	case nil:
+		// continue!
+	case hitch.ErrNoSuchLineage:
+		lin = &api.Lineage{Name: modName}
+	default:
+		return nil, err
+	}
+	lin, err = hitch.LineagePrependRelease(*lin, rel)
+	if err != nil {
+		return nil, err
+	}
+	if err := writeFile(filepath.Join(dir, LineageFilename), *lin); err != nil {
+		return nil, errcat.AppendDetail(err, "ref", string(modName))
+	}
+	return lin, nil
+}
+
+// writeFile writes a lineage to a temporary file and renames it into place.
+// The file is made world-readable (temporary files are created owner-only),
+// since a catalog is often shared, and the directory is synced after the
+// rename, so the new lineage survives a crash.
+// Errors will be of category hitch.ErrStorage.
+func writeFile(path string, lin api.Lineage) error {
+	bs, err := refmt.MarshalAtlased(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, lin, api.Atlas_Catalog)
+	if err != nil {
+		panic(err) // the atlas covers the whole type; this can't fail.
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".tmp.*")
+	if err != nil {
+		return errcat.Errorf(hitch.ErrStorage, "cannot write %q: %s", path, err)
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename.
+	_, err = f.Write(bs)
+	if err == nil {
+		err = f.Chmod(0644)
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return errcat.Errorf(hitch.ErrStorage, "cannot write %q: %s", path, err)
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return errcat.Errorf(hitch.ErrStorage, "cannot write %q: %s", path, err)
+	}
+	if err := syncDir(filepath.Dir(path)); err != nil {
+		return errcat.Errorf(hitch.ErrStorage, "cannot write %q: %s", path, err)
+	}
+	return nil
+}
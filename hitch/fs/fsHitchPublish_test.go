@@ -0,0 +1,132 @@
+package fshitch
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/hitch"
+)
+
+func TestPublishRelease(t *testing.T) {
+	ctx := context.Background()
+	catalog := Catalog{t.TempDir()}
+
+	t.Run("first publish should create the lineage", func(t *testing.T) {
+		lin, err := catalog.PublishRelease(ctx, "example.org/foo", api.Release{Name: "v1", Items: map[api.ItemName]api.WareID{"src": {"git", "1111"}}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, lin, ShouldEqual, &api.Lineage{"example.org/foo", []api.Release{
+			{Name: "v1", Items: map[api.ItemName]api.WareID{"src": {"git", "1111"}}},
+		}})
+		lin2, err := catalog.ViewLineage(ctx, "example.org/foo")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, lin2, ShouldEqual, lin)
+	})
+	t.Run("published lineages should be readable by everyone", func(t *testing.T) {
+		if runtime.GOOS == "windows" {
+			t.Skip("windows doesn't have unix permissions")
+		}
+		fi, err := os.Stat(filepath.Join(catalog.Root, "example.org/foo", LineageFilename))
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, fi.Mode().Perm(), ShouldEqual, os.FileMode(0644))
+	})
+	t.Run("later publishes should prepend", func(t *testing.T) {
+		_, err := catalog.PublishRelease(ctx, "example.org/foo", api.Release{Name: "v2", Items: map[api.ItemName]api.WareID{"src": {"git", "2222"}}})
+		Wish(t, err, ShouldEqual, nil)
+		lin, err := catalog.ViewLineage(ctx, "example.org/foo")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, len(lin.Releases), ShouldEqual, 2)
+		Wish(t, lin.Releases[0].Name, ShouldEqual, api.ReleaseName("v2"))
+		Wish(t, lin.Releases[1].Name, ShouldEqual, api.ReleaseName("v1"))
+	})
+	t.Run("name collisions should be rejected", func(t *testing.T) {
+		_, err := catalog.PublishRelease(ctx, "example.org/foo", api.Release{Name: "v1"})
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrNameCollision)
+		lin, err := catalog.ViewLineage(ctx, "example.org/foo")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, len(lin.Releases), ShouldEqual, 2)
+	})
+	t.Run("invalid names should be rejected", func(t *testing.T) {
+		_, err := catalog.PublishRelease(ctx, "../escape", api.Release{Name: "v1"})
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+		_, err = catalog.PublishRelease(ctx, "example.org/foo", api.Release{})
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+	})
+	t.Run("module names colliding with catalog files should be rejected", func(t *testing.T) {
+		for _, filename := range []string{LineageFilename, MirrorsFilename} {
+			colliding := api.ModuleName("example.org/foo/" + filename)
+			t.Run("after the module "+filename+" would collide with", func(t *testing.T) {
+				catalog := Catalog{t.TempDir()}
+				_, err := catalog.PublishRelease(ctx, "example.org/foo", api.Release{Name: "v1"})
+				Wish(t, err, ShouldEqual, nil)
+				_, err = catalog.PublishRelease(ctx, colliding, api.Release{Name: "v1"})
+				Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+				_, err = catalog.PublishRelease(ctx, "example.org/foo", api.Release{Name: "v2"})
+				Wish(t, err, ShouldEqual, nil)
+				lin, err := catalog.ViewLineage(ctx, "example.org/foo")
+				Wish(t, err, ShouldEqual, nil)
+				Wish(t, len(lin.Releases), ShouldEqual, 2)
+			})
+			t.Run("before the module "+filename+" would collide with", func(t *testing.T) {
+				catalog := Catalog{t.TempDir()}
+				_, err := catalog.PublishRelease(ctx, colliding, api.Release{Name: "v1"})
+				Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+				_, err = catalog.PublishRelease(ctx, "example.org/foo", api.Release{Name: "v1"})
+				Wish(t, err, ShouldEqual, nil)
+				_, err = catalog.ViewLineage(ctx, colliding)
+				Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+				_, err = catalog.ViewWarehouses(ctx, colliding+"/deeper")
+				Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+			})
+		}
+	})
+	t.Run("concurrent publishers should not lose releases", func(t *testing.T) {
+		const n = 20
+		var wg sync.WaitGroup
+		errs := make([]error, n)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				_, errs[i] = catalog.PublishRelease(ctx, "example.org/busy", api.Release{Name: api.ReleaseName(fmt.Sprintf("v%d", i))})
+			}(i)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			Wish(t, err, ShouldEqual, nil)
+		}
+		lin, err := catalog.ViewLineage(ctx, "example.org/busy")
+		Wish(t, err, ShouldEqual, nil)
+		var names []string
+		for _, rel := range lin.Releases {
+			names = append(names, string(rel.Name))
+		}
+		sort.Strings(names)
+		var expect []string
+		for i := 0; i < n; i++ {
+			expect = append(expect, fmt.Sprintf("v%d", i))
+		}
+		sort.Strings(expect)
+		Wish(t, names, ShouldEqual, expect)
+	})
+	t.Run("waiting for the lock should respect cancellation", func(t *testing.T) {
+		_, err := catalog.PublishRelease(ctx, "example.org/locked", api.Release{Name: "v1"})
+		Wish(t, err, ShouldEqual, nil)
+		unlock, err := lockFile(ctx, filepath.Join(catalog.Root, "example.org/locked", LockFilename))
+		Wish(t, err, ShouldEqual, nil)
+		defer unlock()
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+		_, err = catalog.PublishRelease(ctx, "example.org/locked", api.Release{Name: "v2"})
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrCancelled)
+	})
+}
@@ -0,0 +1,78 @@
+package fshitch
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/hitch"
+)
+
+func TestFilesystemCatalog(t *testing.T) {
+	ctx := context.Background()
+	root := t.TempDir()
+	catalog := Catalog{root}
+	write := func(path string, content string) {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		Wish(t, os.MkdirAll(filepath.Dir(path), 0755), ShouldEqual, nil)
+		Wish(t, os.WriteFile(path, []byte(content), 0644), ShouldEqual, nil)
+	}
+	write("example.org/base/lineage.json", `{
+		"name": "example.org/base",
+		"releases": [
+			{"name": "v2", "items": {"linux-amd64": "tar:b2"}, "metadata": {"license": "MIT"}, "hazards": null},
+			{"name": "v1", "items": {"linux-amd64": "tar:b1"}, "metadata": null, "hazards": null}
+		]
+	}`)
+	write("example.org/base/mirrors.json", `{
+		"byPackType": {"tar": ["ca+https://mirror.example.org/"]}
+	}`)
+	write("example.org/bare/lineage.json", `{"name": "example.org/bare", "releases": []}`)
+	write("example.org/corrupt/lineage.json", `{"name": `)
+	write("example.org/misfiled/lineage.json", `{"name": "example.org/other", "releases": []}`)
+
+	t.Run("lineages should be read", func(t *testing.T) {
+		lin, err := catalog.ViewLineage(ctx, "example.org/base")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, lin, ShouldEqual, &api.Lineage{"example.org/base", []api.Release{
+			{Name: "v2", Items: map[api.ItemName]api.WareID{"linux-amd64": {"tar", "b2"}}, Metadata: map[string]string{"license": "MIT"}},
+			{Name: "v1", Items: map[api.ItemName]api.WareID{"linux-amd64": {"tar", "b1"}}},
+		}})
+		wareID, err := hitch.LineagePluckReleaseItem(*lin, "v1", "linux-amd64")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, *wareID, ShouldEqual, api.WareID{"tar", "b1"})
+	})
+	t.Run("mirrors should be read", func(t *testing.T) {
+		ws, err := catalog.ViewWarehouses(ctx, "example.org/base")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, ws, ShouldEqual, &api.WareSourcing{
+			ByPackType: map[api.PackType][]api.WarehouseLocation{"tar": {"ca+https://mirror.example.org/"}},
+		})
+		ws, err = catalog.ViewWarehouses(ctx, "example.org/bare")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, ws, ShouldEqual, &api.WareSourcing{})
+	})
+	t.Run("missing modules should be reported", func(t *testing.T) {
+		_, err := catalog.ViewLineage(ctx, "example.org/nope")
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrNoSuchLineage)
+		_, err = catalog.ViewWarehouses(ctx, "example.org/nope")
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrNoSuchLineage)
+	})
+	t.Run("corrupt lineages should be reported", func(t *testing.T) {
+		_, err := catalog.ViewLineage(ctx, "example.org/corrupt")
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrCorruptState)
+		_, err = catalog.ViewLineage(ctx, "example.org/misfiled")
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrCorruptState)
+	})
+	t.Run("invalid module names should be rejected", func(t *testing.T) {
+		_, err := catalog.ViewLineage(ctx, "../escape")
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+		_, err = catalog.ViewWarehouses(ctx, "")
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrUsage)
+	})
+}
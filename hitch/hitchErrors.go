@@ -6,6 +6,8 @@ const (
 	ErrUsage         ErrorCategory = ("hitch-usage-error")
 	ErrCorruptState  ErrorCategory = ("hitch-corrupt-state")  // Indicates saved state is corrupt somehow (does not parse, or fails invariant checks).
 	ErrNameCollision ErrorCategory = ("hitch-name-collision") // Indicates some mutation could not be performed because it tried to add data under some name that's already used.
+	ErrStorage       ErrorCategory = ("hitch-storage-error")  // Indicates a catalog failed to read or write (permissions errors, full disks, etc).
+	ErrCancelled     ErrorCategory = ("hitch-cancelled")      // Indicates an operation was halted because its context was cancelled.
 )
 
 type LookupError string
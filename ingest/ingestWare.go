@@ -0,0 +1,40 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+// IngestKind_Ware is the IngestKind of imports which name a WareID directly,
+// as the Args (e.g. "ingest:ware:tar:asdf1234").  These are handled by
+// WithWareIngest; they're mostly useful for overriding other imports.
+const IngestKind_Ware = "ware"
+
+/*
+	WithWareIngest wraps an IngestTool so that imports of kind IngestKind_Ware
+	resolve immediately to the WareID they name, without consulting the
+	wrapped tool.  Other kinds of import are passed through to it.
+
+	The WareSourcing returned for such imports is empty; the caller is
+	expected to know where to find the ware already.
+*/
+func WithWareIngest(next IngestTool) IngestTool {
+	return func(ctx context.Context, ingestRef api.ImportRef_Ingest) (*api.WareID, *api.WareSourcing, error) {
+		if ingestRef.IngestKind != IngestKind_Ware {
+			if next == nil {
+				return nil, nil, fmt.Errorf("no ingest tool for kind %q", ingestRef.IngestKind)
+			}
+			return next(ctx, ingestRef)
+		}
+		wareID, err := api.ParseWareID(ingestRef.Args)
+		if err != nil {
+			return nil, nil, err
+		}
+		if wareID.Type == "" || wareID.Hash == "" {
+			return nil, nil, fmt.Errorf("ware ingest %q does not name a complete wareID", ingestRef.Args)
+		}
+		return &wareID, &api.WareSourcing{}, nil
+	}
+}
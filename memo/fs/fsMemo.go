@@ -0,0 +1,112 @@
+package fsmemo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/memo"
+)
+
+var (
+	_ memo.RunRecordStore = Store{}
+)
+
+/*
+	Store is a RunRecordStore backed by a directory on the local filesystem.
+
+	Records are kept one per file, as JSON, at "{Root}/{formulaID}/{guid}.json".
+	Files are written to a temporary name and renamed into place, so readers
+	never see a partially written record.
+*/
+type Store struct {
+	Root string
+}
+
+func (s Store) Put(_ context.Context, rr api.FormulaRunRecord) error {
+	if err := memo.ValidateRunRecordKeys(rr); err != nil {
+		return err
+	}
+	bs, err := refmt.MarshalAtlased(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, rr, api.Atlas_FormulaRunRecord)
+	if err != nil {
+		panic(err) // the atlas covers the whole type; this can't fail.
+	}
+	dir := filepath.Join(s.Root, string(rr.FormulaID))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errcat.Errorf(memo.ErrStorage, "cannot save run record: %s", err)
+	}
+	f, err := os.CreateTemp(dir, ".tmp.*")
+	if err != nil {
+		return errcat.Errorf(memo.ErrStorage, "cannot save run record: %s", err)
+	}
+	defer os.Remove(f.Name()) // no-op after a successful rename.
+	_, err = f.Write(bs)
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		return errcat.Errorf(memo.ErrStorage, "cannot save run record: %s", err)
+	}
+	if err := os.Rename(f.Name(), filepath.Join(dir, rr.Guid+".json")); err != nil {
+		return errcat.Errorf(memo.ErrStorage, "cannot save run record: %s", err)
+	}
+	return nil
+}
+
+func (s Store) Get(ctx context.Context, formulaID api.FormulaSetupHash) (*api.FormulaRunRecord, error) {
+	rrs, err := s.List(ctx, formulaID)
+	if err != nil {
+		return nil, err
+	}
+	return memo.PickSuccessful(rrs), nil
+}
+
+func (s Store) List(_ context.Context, formulaID api.FormulaSetupHash) ([]api.FormulaRunRecord, error) {
+	if err := memo.ValidateFormulaID(formulaID); err != nil {
+		return nil, err
+	}
+	dir := filepath.Join(s.Root, string(formulaID))
+	entries, err := os.ReadDir(dir)
+	switch {
+	case err == nil:
+		// continue!
+	case os.IsNotExist(err):
+		return nil, nil
+	default:
+		return nil, errcat.Errorf(memo.ErrStorage, "cannot list run records: %s", err)
+	}
+	var rrs []api.FormulaRunRecord
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, ".") || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		bs, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, errcat.Errorf(memo.ErrStorage, "cannot read run record: %s", err)
+		}
+		var rr api.FormulaRunRecord
+		if err := refmt.UnmarshalAtlased(json.DecodeOptions{}, bs, &rr, api.Atlas_FormulaRunRecord); err != nil {
+			return nil, errcat.ErrorDetailed(memo.ErrCorruptState,
+				fmt.Sprintf("cannot parse run record %q: %s", filepath.Join(dir, name), err),
+				map[string]string{"formulaID": string(formulaID)},
+			)
+		}
+		if rr.FormulaID != formulaID || rr.Guid+".json" != name {
+			return nil, errcat.ErrorDetailed(memo.ErrCorruptState,
+				fmt.Sprintf("run record %q is filed under the wrong key", filepath.Join(dir, name)),
+				map[string]string{"formulaID": string(formulaID)},
+			)
+		}
+		rrs = append(rrs, rr)
+	}
+	memo.SortRunRecords(rrs)
+	return rrs, nil
+}
@@ -0,0 +1,57 @@
+package fsmemo
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/memo"
+)
+
+func TestFilesystemStore(t *testing.T) {
+	ctx := context.Background()
+	store := Store{t.TempDir()}
+
+	t.Run("empty store lists nothing", func(t *testing.T) {
+		rrs, err := store.List(ctx, "frm1")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, len(rrs), ShouldEqual, 0)
+		rr, err := store.Get(ctx, "frm1")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, rr, ShouldEqual, (*api.FormulaRunRecord)(nil))
+	})
+	t.Run("records roundtrip", func(t *testing.T) {
+		rr := api.FormulaRunRecord{
+			Guid:      "g1",
+			Time:      1500,
+			FormulaID: "frm1",
+			Results:   map[api.AbsPath]api.WareID{"/out": {"tar", "asdf"}},
+			Hostname:  "builder",
+		}
+		Wish(t, store.Put(ctx, rr), ShouldEqual, nil)
+		Wish(t, store.Put(ctx, api.FormulaRunRecord{Guid: "g0", Time: 1000, FormulaID: "frm1", ExitCode: 2}), ShouldEqual, nil)
+		got, err := store.Get(ctx, "frm1")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, *got, ShouldEqual, rr)
+		rrs, err := store.List(ctx, "frm1")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, len(rrs), ShouldEqual, 2)
+		Wish(t, rrs[0].Guid, ShouldEqual, "g0")
+	})
+	t.Run("misfiled records are corrupt", func(t *testing.T) {
+		bs, _ := os.ReadFile(filepath.Join(store.Root, "frm1", "g1.json"))
+		os.MkdirAll(filepath.Join(store.Root, "frm2"), 0755)
+		os.WriteFile(filepath.Join(store.Root, "frm2", "g1.json"), bs, 0644)
+		_, err := store.List(ctx, "frm2")
+		Wish(t, errcat.Category(err), ShouldEqual, memo.ErrCorruptState)
+	})
+	t.Run("unusable keys are rejected", func(t *testing.T) {
+		_, err := store.List(ctx, "../frm1")
+		Wish(t, errcat.Category(err), ShouldEqual, memo.ErrInvalidRecord)
+	})
+}
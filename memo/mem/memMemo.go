@@ -0,0 +1,52 @@
+package memmemo
+
+import (
+	"context"
+	"sync"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/memo"
+)
+
+var (
+	_ memo.RunRecordStore = &Store{}
+)
+
+// Store is a RunRecordStore which keeps everything in memory.
+// The zero value is ready to use.  It is safe for concurrent use.
+type Store struct {
+	mu      sync.Mutex
+	records map[api.FormulaSetupHash]map[string]api.FormulaRunRecord
+}
+
+func (s *Store) Put(_ context.Context, rr api.FormulaRunRecord) error {
+	if err := memo.ValidateRunRecordKeys(rr); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.records == nil {
+		s.records = make(map[api.FormulaSetupHash]map[string]api.FormulaRunRecord)
+	}
+	if s.records[rr.FormulaID] == nil {
+		s.records[rr.FormulaID] = make(map[string]api.FormulaRunRecord)
+	}
+	s.records[rr.FormulaID][rr.Guid] = rr
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, formulaID api.FormulaSetupHash) (*api.FormulaRunRecord, error) {
+	rrs, _ := s.List(ctx, formulaID)
+	return memo.PickSuccessful(rrs), nil
+}
+
+func (s *Store) List(_ context.Context, formulaID api.FormulaSetupHash) ([]api.FormulaRunRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rrs := make([]api.FormulaRunRecord, 0, len(s.records[formulaID]))
+	for _, rr := range s.records[formulaID] {
+		rrs = append(rrs, rr)
+	}
+	memo.SortRunRecords(rrs)
+	return rrs, nil
+}
@@ -0,0 +1,89 @@
+package memmemo
+
+import (
+	"context"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/memo"
+	"github.com/polydawn/go-timeless-api/repeatr"
+)
+
+func TestMemoStore(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{}
+	Wish(t, store.Put(ctx, api.FormulaRunRecord{FormulaID: "frm1", Guid: "g3", Time: 3, ExitCode: 1}), ShouldEqual, nil)
+	Wish(t, store.Put(ctx, api.FormulaRunRecord{FormulaID: "frm1", Guid: "g2", Time: 2}), ShouldEqual, nil)
+	Wish(t, store.Put(ctx, api.FormulaRunRecord{FormulaID: "frm1", Guid: "g1", Time: 1, ExitCode: 1}), ShouldEqual, nil)
+	Wish(t, store.Put(ctx, api.FormulaRunRecord{FormulaID: "frm2", Guid: "g4", Time: 4, ExitCode: 1}), ShouldEqual, nil)
+
+	rr, err := store.Get(ctx, "frm1")
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, rr.Guid, ShouldEqual, "g2")
+	rr, err = store.Get(ctx, "frm2")
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, rr, ShouldEqual, (*api.FormulaRunRecord)(nil))
+
+	rrs, err := store.List(ctx, "frm1")
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, len(rrs), ShouldEqual, 3)
+	Wish(t, rrs[0].Guid, ShouldEqual, "g1")
+	Wish(t, rrs[2].Guid, ShouldEqual, "g3")
+
+	err = store.Put(ctx, api.FormulaRunRecord{FormulaID: "frm1", Guid: "../nope"})
+	Wish(t, errcat.Category(err), ShouldEqual, memo.ErrInvalidRecord)
+}
+
+func TestMemoizeRunFunc(t *testing.T) {
+	ctx := context.Background()
+	store := &Store{}
+	runs := 0
+	var ran api.Formula
+	runFunc := memo.MemoizeRunFunc(store, func(
+		_ context.Context,
+		frm api.Formula,
+		_ repeatr.FormulaContext,
+		_ repeatr.InputControl,
+		_ repeatr.Monitor,
+	) (*api.FormulaRunRecord, error) {
+		runs++
+		ran = frm
+		return &api.FormulaRunRecord{
+			Guid:      "guid" + string(rune('0'+runs)),
+			FormulaID: frm.SetupHash(),
+			Results:   map[api.AbsPath]api.WareID{"/out": {"tar", "asdf"}},
+		}, nil
+	})
+	frm := api.Formula{Action: api.FormulaAction{Exec: []string{"/bin/true"}}}
+
+	rr1, err := runFunc(ctx, frm, repeatr.FormulaContext{}, repeatr.InputControl{}, repeatr.Monitor{})
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, ran, ShouldEqual, frm) // not canonicalized.
+	Wish(t, rr1.FormulaID, ShouldEqual, frm.CanonicalSetupHash())
+	Wish(t, rr1.Metadata, ShouldEqual, map[string]string{memo.MetadataKey_RunFormulaID: string(frm.SetupHash())})
+	stored, err := store.Get(ctx, frm.CanonicalSetupHash())
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, *stored, ShouldEqual, *rr1)
+	Wish(t, stored.Hash(), ShouldEqual, rr1.Hash())
+	listed, err := store.List(ctx, frm.CanonicalSetupHash())
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, listed[0].Hash(), ShouldEqual, rr1.Hash())
+	rr2, err := runFunc(ctx, frm, repeatr.FormulaContext{}, repeatr.InputControl{}, repeatr.Monitor{})
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, runs, ShouldEqual, 1)
+	Wish(t, rr2, ShouldEqual, rr1)
+
+	frm.Action.Cwd = "/task" // the default, spelled out; should still hit.
+	rr3, err := runFunc(ctx, frm, repeatr.FormulaContext{}, repeatr.InputControl{}, repeatr.Monitor{})
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, runs, ShouldEqual, 1)
+	Wish(t, rr3, ShouldEqual, rr1)
+
+	frm.Action.Exec = []string{"/bin/false"}
+	_, err = runFunc(ctx, frm, repeatr.FormulaContext{}, repeatr.InputControl{}, repeatr.Monitor{})
+	Wish(t, err, ShouldEqual, nil)
+	Wish(t, runs, ShouldEqual, 2)
+}
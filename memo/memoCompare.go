@@ -0,0 +1,168 @@
+package memo
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+/*
+	RunRecordComparison reports on the reproducibility of a formula:
+	which of its output paths came out the same in every run, and which
+	diverged (and in which runs).  See CompareRunRecords.
+*/
+type RunRecordComparison struct {
+	FormulaID api.FormulaSetupHash
+	Runs      int // How many records were compared.
+
+	Identical []api.AbsPath  // Output paths which had the same WareID in every run (sorted).
+	Diverged  []DivergedPath // Output paths which didn't (sorted by path).
+
+	// Consensus is the outcome (exit code and results) shared by the most runs.
+	// It's nil if there were no runs, or if two outcomes tie for the most runs.
+	Consensus *RunConsensus
+}
+
+// DivergedPath describes an output path which didn't have the same WareID in
+// every run.
+type DivergedPath struct {
+	Path api.AbsPath
+
+	// Plurality is the WareID that the most runs produced at this path.
+	// It's zero if two WareIDs tie (in which case every run is an outlier),
+	// or if the most runs didn't produce this path at all.
+	Plurality api.WareID
+
+	// Outliers are the runs which didn't produce the Plurality WareID,
+	// in the order of SortRunRecords.
+	Outliers []RunOutlier
+}
+
+// RunOutlier identifies a run which diverged, and what it produced instead.
+// Hostname and Time are copied from its record, to help track down the builder.
+type RunOutlier struct {
+	Guid     string
+	Hostname string
+	Time     int64
+	WareID   api.WareID // Zero if the run didn't produce this path at all.
+}
+
+// RunConsensus is an outcome shared by several runs.
+type RunConsensus struct {
+	Hash     api.RunRecordHash // The FormulaRunRecord.Hash of the runs which agree.
+	ExitCode int
+	Results  map[api.AbsPath]api.WareID
+	Agree    int // How many runs had this outcome.
+}
+
+/*
+	CompareRunRecords compares several records of runs of the same formula
+	(such as the result of RunRecordStore.List), to see whether the formula
+	is reproducible.
+
+	Each output path which appears in any record is checked: a run which
+	lacks a path counts as disagreeing with the runs which have it.
+	Fields of the records which are expected to differ between runs --
+	Guid, Time, Hostname, and Metadata -- are not compared.
+
+	The consensus is a simple plurality vote over each record's outcome
+	(as identified by FormulaRunRecord.Hash), so it considers the exit code
+	as well as the results.
+
+	An error of category ErrInvalidRecord is returned if the records
+	aren't all for the same FormulaID.
+*/
+func CompareRunRecords(rrs []api.FormulaRunRecord) (*RunRecordComparison, error) {
+	cmp := &RunRecordComparison{Runs: len(rrs)}
+	if len(rrs) == 0 {
+		return cmp, nil
+	}
+	cmp.FormulaID = rrs[0].FormulaID
+	for _, rr := range rrs {
+		if rr.FormulaID != cmp.FormulaID {
+			return nil, errcat.ErrorDetailed(ErrInvalidRecord,
+				fmt.Sprintf("cannot compare runs of different formulas (%q and %q)", cmp.FormulaID, rr.FormulaID),
+				map[string]string{"formulaID": string(rr.FormulaID), "guid": rr.Guid},
+			)
+		}
+	}
+	rrs = append([]api.FormulaRunRecord(nil), rrs...)
+	SortRunRecords(rrs)
+
+	// Check each path.
+	paths := map[api.AbsPath]struct{}{}
+	for _, rr := range rrs {
+		for path := range rr.Results {
+			paths[path] = struct{}{}
+		}
+	}
+	sortedPaths := make([]api.AbsPath, 0, len(paths))
+	for path := range paths {
+		sortedPaths = append(sortedPaths, path)
+	}
+	sort.Slice(sortedPaths, func(i, j int) bool { return sortedPaths[i] < sortedPaths[j] })
+	for _, path := range sortedPaths {
+		votes := map[string]int{}
+		for _, rr := range rrs {
+			votes[rr.Results[path].String()]++
+		}
+		if len(votes) == 1 {
+			cmp.Identical = append(cmp.Identical, path)
+			continue
+		}
+		div := DivergedPath{Path: path}
+		winner, ok := plurality(votes)
+		for _, rr := range rrs {
+			wareID := rr.Results[path]
+			if ok && wareID.String() == winner {
+				div.Plurality = wareID
+				continue
+			}
+			div.Outliers = append(div.Outliers, RunOutlier{
+				Guid:     rr.Guid,
+				Hostname: rr.Hostname,
+				Time:     rr.Time,
+				WareID:   wareID,
+			})
+		}
+		cmp.Diverged = append(cmp.Diverged, div)
+	}
+
+	// Vote on the whole outcome.
+	outcomeVotes := map[string]int{}
+	firstByHash := map[string]api.FormulaRunRecord{}
+	for _, rr := range rrs {
+		h := string(rr.Hash())
+		outcomeVotes[h]++
+		if _, ok := firstByHash[h]; !ok {
+			firstByHash[h] = rr
+		}
+	}
+	if winner, ok := plurality(outcomeVotes); ok {
+		rr := firstByHash[winner]
+		cmp.Consensus = &RunConsensus{
+			Hash:     api.RunRecordHash(winner),
+			ExitCode: rr.ExitCode,
+			Results:  rr.Results,
+			Agree:    outcomeVotes[winner],
+		}
+	}
+	return cmp, nil
+}
+
+// plurality returns the key with the most votes, or false if there's a tie.
+func plurality(votes map[string]int) (string, bool) {
+	winner, best, tied := "", 0, false
+	for k, n := range votes {
+		switch {
+		case n > best:
+			winner, best, tied = k, n, false
+		case n == best:
+			tied = true
+		}
+	}
+	return winner, !tied
+}
@@ -0,0 +1,72 @@
+package memo
+
+import (
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+func TestCompareRunRecords(t *testing.T) {
+	good := map[api.AbsPath]api.WareID{"/out": {"tar", "aaaa"}, "/log": {"tar", "1111"}}
+	rrs := []api.FormulaRunRecord{
+		{Guid: "g3", Time: 3, FormulaID: "frm1", Results: map[api.AbsPath]api.WareID{"/out": {"tar", "bbbb"}, "/log": {"tar", "1111"}}, Hostname: "hostC"},
+		{Guid: "g1", Time: 1, FormulaID: "frm1", Results: good, Hostname: "hostA"},
+		{Guid: "g2", Time: 2, FormulaID: "frm1", Results: good, Hostname: "hostB", Metadata: map[string]string{"x": "y"}},
+		{Guid: "g4", Time: 4, FormulaID: "frm1", Results: map[api.AbsPath]api.WareID{"/out": {"tar", "aaaa"}, "/log": {"tar", "1111"}, "/extra": {"tar", "eeee"}}, Hostname: "hostD"},
+	}
+
+	t.Run("divergence and consensus should be reported", func(t *testing.T) {
+		cmp, err := CompareRunRecords(rrs)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cmp, ShouldEqual, &RunRecordComparison{
+			FormulaID: "frm1",
+			Runs:      4,
+			Identical: []api.AbsPath{"/log"},
+			Diverged: []DivergedPath{
+				{Path: "/extra", Outliers: []RunOutlier{
+					{"g4", "hostD", 4, api.WareID{"tar", "eeee"}},
+				}},
+				{Path: "/out", Plurality: api.WareID{"tar", "aaaa"}, Outliers: []RunOutlier{
+					{"g3", "hostC", 3, api.WareID{"tar", "bbbb"}},
+				}},
+			},
+			Consensus: &RunConsensus{
+				Hash:     rrs[1].Hash(),
+				ExitCode: 0,
+				Results:  good,
+				Agree:    2,
+			},
+		})
+	})
+	t.Run("ties should have no consensus", func(t *testing.T) {
+		cmp, err := CompareRunRecords(rrs[:2])
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cmp.Consensus, ShouldEqual, (*RunConsensus)(nil))
+		Wish(t, cmp.Diverged, ShouldEqual, []DivergedPath{
+			{Path: "/out", Outliers: []RunOutlier{
+				{"g1", "hostA", 1, api.WareID{"tar", "aaaa"}},
+				{"g3", "hostC", 3, api.WareID{"tar", "bbbb"}},
+			}},
+		})
+	})
+	t.Run("exit codes should count toward consensus", func(t *testing.T) {
+		failed := api.FormulaRunRecord{Guid: "g5", Time: 5, FormulaID: "frm1", ExitCode: 1, Results: good}
+		cmp, err := CompareRunRecords([]api.FormulaRunRecord{rrs[1], failed, failed})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cmp.Identical, ShouldEqual, []api.AbsPath{"/log", "/out"})
+		Wish(t, cmp.Consensus.ExitCode, ShouldEqual, 1)
+		Wish(t, cmp.Consensus.Agree, ShouldEqual, 2)
+	})
+	t.Run("mixed formulas should be rejected", func(t *testing.T) {
+		_, err := CompareRunRecords([]api.FormulaRunRecord{rrs[0], {Guid: "g9", FormulaID: "frm2"}})
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidRecord)
+	})
+	t.Run("no records should compare empty", func(t *testing.T) {
+		cmp, err := CompareRunRecords(nil)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, cmp, ShouldEqual, &RunRecordComparison{})
+	})
+}
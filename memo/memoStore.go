@@ -0,0 +1,164 @@
+/*
+	Interfaces for memoizing formula runs.
+
+	A Formula's SetupHash identifies the computation it describes, so if
+	we've already got a FormulaRunRecord for a successful run of a formula
+	with the same SetupHash, there's no need to run it again: the record
+	already says what the results are.  A RunRecordStore keeps those records.
+
+	Implementations live in subpackages: one in-memory (`memo/mem`),
+	and one backed by a plain directory on the filesystem (`memo/fs`).
+*/
+package memo
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/repeatr"
+)
+
+type RunRecordStore interface {
+	// Put saves a record.
+	// Saving a record with the same FormulaID and Guid as one already
+	// stored replaces it.
+	//
+	// Errors will be of category ErrInvalidRecord or ErrStorage.
+	Put(context.Context, api.FormulaRunRecord) error
+
+	// Get returns a record of a successful run (one which exited zero) of
+	// the formula with the given ID.  If there is more than one, the
+	// earliest is returned.
+	//
+	// A pointer is returned to express maybe-ness: if there is no record
+	// of a successful run, both the pointer and the error are nil.
+	Get(context.Context, api.FormulaSetupHash) (*api.FormulaRunRecord, error)
+
+	// List returns all records of runs of the formula with the given ID,
+	// successful or not, sorted by time (and by Guid as a tiebreaker).
+	List(context.Context, api.FormulaSetupHash) ([]api.FormulaRunRecord, error)
+}
+
+type ErrorCategory string
+
+const (
+	ErrInvalidRecord ErrorCategory = ("memo-invalid-record") // Indicates a record can't be stored because it's missing (or has unusable) key fields.
+	ErrCorruptState  ErrorCategory = ("memo-corrupt-state")  // Indicates saved state is corrupt somehow (does not parse, or is filed under the wrong key).
+	ErrStorage       ErrorCategory = ("memo-storage-error")  // Indicates the store failed to read or write (permissions errors, full disks, etc).
+)
+
+// MetadataKey_RunFormulaID is the FormulaRunRecord.Metadata key under which
+// MemoizeRunFunc records the FormulaID the run itself reported (the SetupHash
+// of the formula as given, which may differ from the canonical one).
+const MetadataKey_RunFormulaID = "formulaID.run"
+
+// keys must be safe to use as filenames, and FormulaSetupHash and most guid
+// formats easily fit within these constraints.
+var validation_key_regexp = regexp.MustCompile("^[a-zA-Z0-9][-_a-zA-Z0-9]*$")
+
+// ValidateRunRecordKeys returns an error of category ErrInvalidRecord if the
+// record doesn't have a usable FormulaID and Guid.  Both are required to store
+// a record, and must be nonempty alphanumeric strings (dashes and underscores
+// are also allowed after the first character).
+func ValidateRunRecordKeys(rr api.FormulaRunRecord) error {
+	if err := ValidateFormulaID(rr.FormulaID); err != nil {
+		return errcat.AppendDetail(err, "guid", rr.Guid)
+	}
+	if !validation_key_regexp.MatchString(rr.Guid) {
+		return errcat.ErrorDetailed(ErrInvalidRecord,
+			fmt.Sprintf("run record guid %q is not a usable key", rr.Guid),
+			map[string]string{"formulaID": string(rr.FormulaID)},
+		)
+	}
+	return nil
+}
+
+// ValidateFormulaID returns an error of category ErrInvalidRecord if the
+// FormulaSetupHash is not usable as a key.  (Hashes produced by
+// Formula.SetupHash always are.)
+func ValidateFormulaID(formulaID api.FormulaSetupHash) error {
+	if !validation_key_regexp.MatchString(string(formulaID)) {
+		return errcat.ErrorDetailed(ErrInvalidRecord,
+			fmt.Sprintf("formulaID %q is not a usable key", formulaID),
+			map[string]string{"formulaID": string(formulaID)},
+		)
+	}
+	return nil
+}
+
+// SortRunRecords sorts records by time, and by Guid as a tiebreaker.
+// This is the order RunRecordStore.List returns.
+func SortRunRecords(rrs []api.FormulaRunRecord) {
+	sort.Slice(rrs, func(i, j int) bool {
+		if rrs[i].Time != rrs[j].Time {
+			return rrs[i].Time < rrs[j].Time
+		}
+		return rrs[i].Guid < rrs[j].Guid
+	})
+}
+
+// PickSuccessful returns the first record in the slice which exited zero,
+// or nil if there is none.  Combined with SortRunRecords, this is the
+// behavior of RunRecordStore.Get.
+func PickSuccessful(rrs []api.FormulaRunRecord) *api.FormulaRunRecord {
+	for _, rr := range rrs {
+		if rr.ExitCode == 0 {
+			return &rr
+		}
+	}
+	return nil
+}
+
+/*
+	MemoizeRunFunc wraps a RunFunc so that formulas with a successful record
+	in the store aren't run again: the stored record is returned instead.
+	Records of formulas that do get run are saved into the store (whether
+	they're successful or not).
+
+	When a stored record is used, it's also sent to the monitor as an
+	Event_Result, just as if it had been run.
+
+	Records are stored and looked up by the formula's CanonicalSetupHash,
+	so a formula which spells out default values finds the records of one
+	which doesn't, and vice versa.  The formula run is exactly the one given,
+	but the record saved has the canonical hash as its FormulaID, and the
+	SetupHash of the formula as run under MetadataKey_RunFormulaID.
+	The record returned is always exactly the one in the store, so its Hash
+	(and any signature over it) agrees with what Get and List return later.
+*/
+func MemoizeRunFunc(store RunRecordStore, runFunc repeatr.RunFunc) repeatr.RunFunc {
+	return func(
+		ctx context.Context,
+		frm api.Formula,
+		frmCtx repeatr.FormulaContext,
+		input repeatr.InputControl,
+		monitor repeatr.Monitor,
+	) (*api.FormulaRunRecord, error) {
+		key := frm.CanonicalSetupHash()
+		rr, err := store.Get(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		if rr != nil {
+			monitor.Send(repeatr.Event_Result{Record: rr})
+			return rr, nil
+		}
+		rr, err = runFunc(ctx, frm, frmCtx, input, monitor)
+		if err != nil || rr == nil {
+			return rr, err
+		}
+		metadata := make(map[string]string, len(rr.Metadata)+1)
+		for k, v := range rr.Metadata {
+			metadata[k] = v
+		}
+		metadata[MetadataKey_RunFormulaID] = string(rr.FormulaID)
+		rr.Metadata = metadata
+		rr.FormulaID = key
+		return rr, store.Put(ctx, *rr)
+	}
+}
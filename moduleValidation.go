@@ -0,0 +1,176 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ValidationErrors is a list of every problem found by a validation method
+// (such as Module.Validate) which reports all problems at once, rather than
+// halting on the first.
+type ValidationErrors []error
+
+func (e ValidationErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	if len(e) == 1 {
+		return msgs[0]
+	}
+	return fmt.Sprintf("%d problems: %s", len(e), strings.Join(msgs, "; "))
+}
+
+/*
+	Validate checks the structure of a Module (and all its submodules) and
+	returns a ValidationErrors listing every problem found, or nil.
+
+	The checks are:
+
+	  - step, slot, and item names must be legal
+	    (see StepName.Validate, SlotName.Validate, ItemName.Validate);
+	  - catalog imports must have a valid ModuleName and a release and item;
+	  - ingest imports may only appear in the root module;
+	  - parent imports may only appear in submodules, and must refer to an
+	    import or step output that exists in the enclosing module;
+	  - each input of an Operation must refer to an import or step output
+	    that exists in the module;
+	  - no two input paths of an Operation may refer to the same path;
+	  - exports must refer to an import or step output that exists in the module.
+
+	Validate does not detect cycles in the step graph; ModuleOrderSteps does.
+
+	Problems are reported with the dotted path to the step they were found in,
+	and the list is sorted, so the result is deterministic.
+*/
+func (m Module) Validate() error {
+	var errs ValidationErrors
+	m.validate("", nil, &errs)
+	if len(errs) == 0 {
+		return nil
+	}
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return errs
+}
+
+// validate accumulates problems into `errs`.
+// `at` is where this module is, and `parent` is the enclosing module
+// (or nil if this is the root).
+func (m Module) validate(at SubmoduleRef, parent *Module, errs *ValidationErrors) {
+	where := func(stepName StepName) string {
+		return SubmoduleStepRef{at, stepName}.String()
+	}
+	report := func(loc string, format string, args ...interface{}) {
+		msg := fmt.Sprintf(format, args...)
+		if loc != "" {
+			msg = loc + ": " + msg
+		}
+		*errs = append(*errs, errors.New(msg))
+	}
+
+	// Imports.
+	for slotName, imp := range m.Imports {
+		if err := slotName.Validate(); err != nil {
+			report(string(at), "import %q: %s", slotName, err)
+		}
+		switch imp2 := imp.(type) {
+		case ImportRef_Catalog:
+			if err := imp2.ModuleName.Validate(); err != nil {
+				report(string(at), "import %q: %s", slotName, err)
+			}
+			if imp2.ReleaseName == "" || imp2.ItemName == "" {
+				report(string(at), "import %q: catalog imports must specify a release and an item", slotName)
+			}
+		case ImportRef_Ingest:
+			if parent != nil {
+				report(string(at), "import %q: ingest imports are only allowed in the root module", slotName)
+			}
+		case ImportRef_Parent:
+			if parent == nil {
+				report(string(at), "import %q: parent imports are only allowed in submodules", slotName)
+				break
+			}
+			if SlotRef(imp2).StepName == at.Last() {
+				report(string(at), "import %q: parent import %q refers to this submodule itself", slotName, imp2)
+				break
+			}
+			if err := parent.checkSlotRef(SlotRef(imp2)); err != nil {
+				report(string(at), "import %q: parent import %q is invalid: %s", slotName, imp2, err)
+			}
+		case nil:
+			report(string(at), "import %q: import is empty", slotName)
+		}
+	}
+
+	// Steps.
+	for stepName, step := range m.Steps {
+		if err := stepName.Validate(); err != nil {
+			report(where(stepName), "%s", err)
+		}
+		switch x := step.(type) {
+		case Operation:
+			paths := make([]AbsPath, 0, len(x.Inputs))
+			for p := range x.Inputs {
+				paths = append(paths, p)
+			}
+			SortMountOrder(paths)
+			cleanPaths := make(map[AbsPath]AbsPath, len(paths))
+			for _, p := range paths {
+				if err := m.checkSlotRef(x.Inputs[p]); err != nil {
+					report(where(stepName), "input %q: %s", p, err)
+				}
+				clean := p.Clean()
+				if other, ok := cleanPaths[clean]; ok {
+					report(where(stepName), "inputs %q and %q collide", other, p)
+					continue
+				}
+				cleanPaths[clean] = p
+			}
+			for slotName := range x.Outputs {
+				if err := slotName.Validate(); err != nil {
+					report(where(stepName), "output %q: %s", slotName, err)
+				}
+			}
+		case Module:
+			x.validate(at.Child(stepName), &m, errs)
+		case nil:
+			report(where(stepName), "step is empty")
+		}
+	}
+
+	// Exports.
+	for itemName, slotRef := range m.Exports {
+		if err := itemName.Validate(); err != nil {
+			report(string(at), "export %q: %s", itemName, err)
+		}
+		if err := m.checkSlotRef(slotRef); err != nil {
+			report(string(at), "export %q: %s", itemName, err)
+		}
+	}
+}
+
+// checkSlotRef returns an error if the SlotRef doesn't refer to an import
+// or step output that exists in this module.
+func (m Module) checkSlotRef(ref SlotRef) error {
+	if ref.StepName == "" {
+		if _, ok := m.Imports[ref.SlotName]; !ok {
+			return fmt.Errorf("%q is not the name of an import", ref.SlotName)
+		}
+		return nil
+	}
+	switch x := m.Steps[ref.StepName].(type) {
+	case Operation:
+		if _, ok := x.Outputs[ref.SlotName]; !ok {
+			return fmt.Errorf("step %q has no output named %q", ref.StepName, ref.SlotName)
+		}
+	case Module:
+		if _, ok := x.Exports[ItemName(ref.SlotName)]; !ok {
+			return fmt.Errorf("step %q has no export named %q", ref.StepName, ref.SlotName)
+		}
+	default:
+		return fmt.Errorf("%q is not the name of a step", ref.StepName)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+)
+
+func TestLocalNameValidation(t *testing.T) {
+	type tcase struct {
+		Value StepName
+		Error error
+	}
+	for _, tr := range []tcase{
+		{"", fmt.Errorf("a stepName cannot be an empty string")},
+		{"yes", nil},
+		{"step-A_1", nil},
+		{"_yes", nil},
+		{"-no", fmtMatchError("stepName", validation_localName_msg)},
+		{"no.dots", fmtMatchError("stepName", validation_localName_msg)},
+		{"no:colons", fmtMatchError("stepName", validation_localName_msg)},
+		{"no/slashes", fmtMatchError("stepName", validation_localName_msg)},
+	} {
+		t.Run(string(tr.Value), func(t *testing.T) {
+			Wish(t, tr.Value.Validate(), ShouldEqual, tr.Error)
+		})
+	}
+}
+
+func TestModuleValidation(t *testing.T) {
+	t.Run("valid module should pass", func(t *testing.T) {
+		mod := Module{
+			Imports: map[SlotName]ImportRef{
+				"base": ImportRef_Catalog{"publishing.group/base", "v2018", "bin-linux-amd64"},
+				"src":  ImportRef_Ingest{"git", ".:HEAD"},
+			},
+			Steps: map[StepName]StepUnion{
+				"stepA": Operation{
+					Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}, "/src": {"", "src"}},
+					Outputs: map[SlotName]AbsPath{"out": "/out"},
+				},
+				"stepB": Module{
+					Imports: map[SlotName]ImportRef{
+						"x": ImportRef_Parent{"stepA", "out"},
+					},
+					Steps: map[StepName]StepUnion{
+						"op": Operation{
+							Inputs:  map[AbsPath]SlotRef{"/": {"", "x"}},
+							Outputs: map[SlotName]AbsPath{"out": "/out"},
+						},
+					},
+					Exports: map[ItemName]SlotRef{"bexp": {"op", "out"}},
+				},
+			},
+			Exports: map[ItemName]SlotRef{
+				"src":     {"", "src"},
+				"linux-z": {"stepB", "bexp"},
+			},
+		}
+		Wish(t, mod.Validate(), ShouldEqual, nil)
+	})
+	t.Run("all problems should be reported", func(t *testing.T) {
+		mod := Module{
+			Imports: map[SlotName]ImportRef{
+				"base":  ImportRef_Catalog{"Not..Valid", "v1", "x"},
+				"up":    ImportRef_Parent{"", "nope"},
+				"bad.x": ImportRef_Ingest{"git", ".:HEAD"},
+			},
+			Steps: map[StepName]StepUnion{
+				"stepA": Operation{
+					Inputs: map[AbsPath]SlotRef{
+						"/a":  {"", "base"},
+						"/a/": {"", "base"},
+						"/b":  {"", "missing"},
+						"/c":  {"stepB", "nope"},
+					},
+					Outputs: map[SlotName]AbsPath{"out": "/out"},
+				},
+				"stepB": Module{
+					Imports: map[SlotName]ImportRef{
+						"x":   ImportRef_Parent{"stepA", "wrong"},
+						"y":   ImportRef_Ingest{"git", ".:HEAD"},
+						"me":  ImportRef_Parent{"stepB", "bexp"},
+						"ok":  ImportRef_Parent{"", "base"},
+						"ok2": ImportRef_Parent{"stepA", "out"},
+					},
+					Steps: map[StepName]StepUnion{
+						"op": Operation{
+							Inputs:  map[AbsPath]SlotRef{"/": {"", "ok"}},
+							Outputs: map[SlotName]AbsPath{"out": "/out"},
+						},
+					},
+					Exports: map[ItemName]SlotRef{"bexp": {"op", "nope"}},
+				},
+			},
+			Exports: map[ItemName]SlotRef{
+				"fine": {"stepA", "out"},
+				"gone": {"stepZ", "out"},
+			},
+		}
+		err := mod.Validate()
+		var msgs []string
+		for _, err := range err.(ValidationErrors) {
+			msgs = append(msgs, err.Error())
+		}
+		Wish(t, msgs, ShouldEqual, []string{
+			`export "gone": "stepZ" is not the name of a step`,
+			`import "bad.x": a slotName must consist of alphanumeric characters, '-', or '_', and must not start with '-'`,
+			`import "base": a moduleName must consist of lower case alphanumeric characters, '-' or '.', and must start and end with an alphanumeric character`,
+			`import "up": parent imports are only allowed in submodules`,
+			`stepA: input "/b": "missing" is not the name of an import`,
+			`stepA: input "/c": step "stepB" has no export named "nope"`,
+			`stepA: inputs "/a" and "/a/" collide`,
+			`stepB: export "bexp": step "op" has no output named "nope"`,
+			`stepB: import "me": parent import "parent:stepB.bexp" refers to this submodule itself`,
+			`stepB: import "x": parent import "parent:stepA.wrong" is invalid: step "stepA" has no output named "wrong"`,
+			`stepB: import "y": ingest imports are only allowed in the root module`,
+		})
+	})
+}
@@ -2,6 +2,13 @@ package api
 
 import "github.com/polydawn/refmt/obj/atlas"
 
+var (
+	Atlas_OperationRecord = atlas.MustBuild(
+		OperationRecord_AtlasEntry,
+		WareID_AtlasEntry,
+	)
+)
+
 var (
 	Operation_AtlasEntry       = atlas.BuildEntry(Operation{}).StructMap().Autogenerate().Complete()
 	OperationRecord_AtlasEntry = atlas.BuildEntry(OperationRecord{}).StructMap().Autogenerate().Complete()
@@ -81,3 +81,23 @@ func TestOperationSerialization(t *testing.T) {
 		})
 	})
 }
+
+func TestOperationRecordSerialization(t *testing.T) {
+	obj := OperationRecord{
+		FormulaRunRecord: FormulaRunRecord{Guid: "g1", Time: 1000, FormulaID: "frm1", Hostname: "builder-a"},
+		Results:          map[SlotName]WareID{"bar": {"tar", "asdf"}},
+	}
+	canon := `{"guid":"g1","time":1000,"formulaID":"frm1","exitCode":0,"hostname":"builder-a","results":{"bar":"tar:asdf"}}`
+
+	t.Run("marshal", func(t *testing.T) {
+		bs, err := refmt.MarshalAtlased(json.EncodeOptions{}, obj, Atlas_OperationRecord)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, string(bs), ShouldEqual, canon)
+	})
+	t.Run("unmarshal", func(t *testing.T) {
+		targ := OperationRecord{}
+		err := refmt.UnmarshalAtlased(json.DecodeOptions{}, bytes.NewBufferString(canon).Bytes(), &targ, Atlas_OperationRecord)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, targ, ShouldEqual, obj)
+	})
+}
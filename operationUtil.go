@@ -0,0 +1,106 @@
+package api
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+/*
+	OperationRecordFromRunRecord converts the record of running an Operation's
+	formula into an OperationRecord, using the Operation's Outputs to key the
+	results by SlotName.
+
+	An error is returned if the results don't match the operation's declared
+	outputs: if any output is missing from the results, or if the results
+	contain a path which isn't an output.  The returned record is still filled
+	in as far as possible (every output which is present is included),
+	since a record with partial results is useful for reporting failures.
+
+	The embedded FormulaRunRecord's Results (keyed by path) are left nil;
+	they'd be redundant, and are shadowed by the OperationRecord's own Results.
+*/
+func OperationRecordFromRunRecord(op Operation, frr FormulaRunRecord) (OperationRecord, error) {
+	rec := OperationRecord{
+		FormulaRunRecord: frr,
+		Results:          make(map[SlotName]WareID, len(op.Outputs)),
+	}
+	rec.FormulaRunRecord.Results = nil
+	var missing []string
+	for _, slotName := range sortedOutputSlots(op) {
+		path := op.Outputs[slotName]
+		if wareID, ok := frr.Results[path]; ok {
+			rec.Results[slotName] = wareID
+		} else {
+			missing = append(missing, fmt.Sprintf("%q (path %q)", slotName, path))
+		}
+	}
+	if len(missing) > 0 {
+		return rec, fmt.Errorf("run record is missing results for outputs %s", strings.Join(missing, ", "))
+	}
+	paths := make(map[AbsPath]struct{}, len(op.Outputs))
+	for _, path := range op.Outputs {
+		paths[path] = struct{}{}
+	}
+	var extra []string
+	for path := range frr.Results {
+		if _, ok := paths[path]; !ok {
+			extra = append(extra, fmt.Sprintf("%q", path))
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		return rec, fmt.Errorf("run record has results for paths %s which are not outputs of the operation", strings.Join(extra, ", "))
+	}
+	return rec, nil
+}
+
+/*
+	RunRecordFromOperationRecord converts an OperationRecord back into
+	a FormulaRunRecord, using the Operation's Outputs to key the results by path.
+
+	An error is returned if the results don't match the operation's declared
+	outputs: if any output is missing from the results, or if the results
+	contain a SlotName which isn't an output.  An error is also returned if
+	two outputs share a path, but the record has different results for them.
+*/
+func RunRecordFromOperationRecord(op Operation, rec OperationRecord) (FormulaRunRecord, error) {
+	frr := rec.FormulaRunRecord
+	frr.Results = make(map[AbsPath]WareID, len(op.Outputs))
+	var missing []string
+	for _, slotName := range sortedOutputSlots(op) {
+		path := op.Outputs[slotName]
+		wareID, ok := rec.Results[slotName]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%q", slotName))
+			continue
+		}
+		if other, ok := frr.Results[path]; ok && other != wareID {
+			return frr, fmt.Errorf("operation record has conflicting results for path %q", path)
+		}
+		frr.Results[path] = wareID
+	}
+	if len(missing) > 0 {
+		return frr, fmt.Errorf("operation record is missing results for outputs %s", strings.Join(missing, ", "))
+	}
+	var extra []string
+	for slotName := range rec.Results {
+		if _, ok := op.Outputs[slotName]; !ok {
+			extra = append(extra, fmt.Sprintf("%q", slotName))
+		}
+	}
+	if len(extra) > 0 {
+		sort.Strings(extra)
+		return frr, fmt.Errorf("operation record has results for slots %s which are not outputs of the operation", strings.Join(extra, ", "))
+	}
+	return frr, nil
+}
+
+func sortedOutputSlots(op Operation) []SlotName {
+	slotNames := make([]SlotName, 0, len(op.Outputs))
+	for slotName := range op.Outputs {
+		slotNames = append(slotNames, slotName)
+	}
+	sort.Slice(slotNames, func(i, j int) bool { return slotNames[i] < slotNames[j] })
+	return slotNames
+}
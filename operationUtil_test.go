@@ -0,0 +1,67 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+)
+
+func TestOperationRecordConversion(t *testing.T) {
+	op := Operation{
+		Inputs:  map[AbsPath]SlotRef{"/": {"", "base"}},
+		Action:  FormulaAction{Exec: []string{"/bin/true"}},
+		Outputs: map[SlotName]AbsPath{"out": "/out", "log": "/var/log"},
+	}
+	frr := FormulaRunRecord{
+		Guid:      "g1",
+		Time:      1000,
+		FormulaID: "frm1",
+		Results:   map[AbsPath]WareID{"/out": {"tar", "0u7"}, "/var/log": {"tar", "106"}},
+	}
+	rec := OperationRecord{
+		FormulaRunRecord: FormulaRunRecord{Guid: "g1", Time: 1000, FormulaID: "frm1"},
+		Results:          map[SlotName]WareID{"out": {"tar", "0u7"}, "log": {"tar", "106"}},
+	}
+
+	t.Run("conversion should roundtrip", func(t *testing.T) {
+		rec2, err := OperationRecordFromRunRecord(op, frr)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, rec2, ShouldEqual, rec)
+		frr2, err := RunRecordFromOperationRecord(op, rec2)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, frr2, ShouldEqual, frr)
+	})
+	t.Run("missing results should be reported", func(t *testing.T) {
+		frr2 := frr
+		frr2.Results = map[AbsPath]WareID{"/out": {"tar", "0u7"}}
+		rec2, err := OperationRecordFromRunRecord(op, frr2)
+		Wish(t, err, ShouldEqual, fmt.Errorf(`run record is missing results for outputs "log" (path "/var/log")`))
+		Wish(t, rec2.Results, ShouldEqual, map[SlotName]WareID{"out": {"tar", "0u7"}})
+
+		rec2 = rec
+		rec2.Results = map[SlotName]WareID{}
+		_, err = RunRecordFromOperationRecord(op, rec2)
+		Wish(t, err, ShouldEqual, fmt.Errorf(`operation record is missing results for outputs "log", "out"`))
+	})
+	t.Run("extra results should be reported", func(t *testing.T) {
+		frr2 := frr
+		frr2.Results = map[AbsPath]WareID{"/out": {"tar", "0u7"}, "/var/log": {"tar", "106"}, "/tmp": {"tar", "7"}}
+		_, err := OperationRecordFromRunRecord(op, frr2)
+		Wish(t, err, ShouldEqual, fmt.Errorf(`run record has results for paths "/tmp" which are not outputs of the operation`))
+
+		rec2 := rec
+		rec2.Results = map[SlotName]WareID{"out": {"tar", "0u7"}, "log": {"tar", "106"}, "x": {"tar", "7"}}
+		_, err = RunRecordFromOperationRecord(op, rec2)
+		Wish(t, err, ShouldEqual, fmt.Errorf(`operation record has results for slots "x" which are not outputs of the operation`))
+	})
+	t.Run("outputs sharing a path should agree", func(t *testing.T) {
+		op2 := Operation{Outputs: map[SlotName]AbsPath{"a": "/out", "b": "/out"}}
+		rec2, err := OperationRecordFromRunRecord(op2, FormulaRunRecord{Results: map[AbsPath]WareID{"/out": {"tar", "0u7"}}})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, rec2.Results, ShouldEqual, map[SlotName]WareID{"a": {"tar", "0u7"}, "b": {"tar", "0u7"}})
+		rec2.Results["b"] = WareID{"tar", "other"}
+		_, err = RunRecordFromOperationRecord(op2, rec2)
+		Wish(t, err, ShouldEqual, fmt.Errorf(`operation record has conflicting results for path "/out"`))
+	})
+}
@@ -0,0 +1,114 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+/*
+	Validate returns an error if the path isn't absolute, or isn't clean
+	(i.e. would be changed by Clean).
+
+	Paths in formulas and operations should always be valid;
+	see Formula.Validate.
+*/
+func (p AbsPath) Validate() error {
+	if !path.IsAbs(string(p)) {
+		return errors.New("path must be absolute")
+	}
+	if clean := p.Clean(); clean != p {
+		return fmt.Errorf("path is not clean (should be %q)", clean)
+	}
+	return nil
+}
+
+// Clean returns the shortest equivalent of the path, as by path.Clean:
+// repeated and trailing slashes are removed, and "." and ".." elements are
+// resolved.  (Clean doesn't make a relative path absolute.)
+func (p AbsPath) Clean() AbsPath {
+	return AbsPath(path.Clean(string(p)))
+}
+
+// Join appends elements to the path, and cleans the result.
+// Since ".." of the root is the root, the result never escapes the path's root.
+func (p AbsPath) Join(elem ...string) AbsPath {
+	return AbsPath(path.Join(append([]string{string(p)}, elem...)...))
+}
+
+// IsAncestorOf returns true if the other path is strictly inside this one
+// (after both are cleaned).  A path is not its own ancestor.
+func (p AbsPath) IsAncestorOf(other AbsPath) bool {
+	a, b := p.Clean(), other.Clean()
+	if a == b {
+		return false
+	}
+	if a == "/" {
+		return path.IsAbs(string(b))
+	}
+	return strings.HasPrefix(string(b), string(a)+"/")
+}
+
+/*
+	Rel returns the relative path from this path to the target path,
+	which must be this path or inside it.  For example,
+	AbsPath("/a").Rel("/a/b/c") is "b/c", and AbsPath("/a").Rel("/a") is ".".
+
+	An error is returned if the target isn't inside this path;
+	unlike filepath.Rel, Rel never returns a path containing "..".
+*/
+func (p AbsPath) Rel(target AbsPath) (string, error) {
+	a, b := p.Clean(), target.Clean()
+	switch {
+	case a == b:
+		return ".", nil
+	case !a.IsAncestorOf(b):
+		return "", fmt.Errorf("path %q is not inside %q", target, p)
+	case a == "/":
+		return string(b[1:]), nil
+	default:
+		return string(b[len(a)+1:]), nil
+	}
+}
+
+/*
+	AbsPathList sorts paths into mount order: a path always sorts before any
+	path inside it, and paths are otherwise compared element by element
+	(so "/a/b" sorts before "/a-b", keeping each subtree together).
+	Paths are compared in their cleaned form; paths which are the same once
+	cleaned (e.g. "/a" and "/a/") are ordered by their original form.
+
+	This is the order in which inputs must be mounted to assemble a filesystem,
+	since mounting a parent after a child would shadow the child.
+	Tools should always use this ordering, so that they agree.
+*/
+type AbsPathList []AbsPath
+
+func (s AbsPathList) Len() int      { return len(s) }
+func (s AbsPathList) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s AbsPathList) Less(i, j int) bool {
+	a, b := s[i].Clean(), s[j].Clean()
+	if a == b {
+		return s[i] < s[j]
+	}
+	for k := 0; k < len(a) && k < len(b); k++ {
+		switch {
+		case a[k] == b[k]:
+			continue
+		case a[k] == '/':
+			return true
+		case b[k] == '/':
+			return false
+		default:
+			return a[k] < b[k]
+		}
+	}
+	return len(a) < len(b)
+}
+
+// SortMountOrder sorts the paths in place into mount order (see AbsPathList).
+func SortMountOrder(paths []AbsPath) {
+	sort.Sort(AbsPathList(paths))
+}
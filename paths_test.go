@@ -0,0 +1,51 @@
+package api
+
+import (
+	"fmt"
+	"testing"
+
+	. "github.com/warpfork/go-wish"
+)
+
+func TestAbsPath(t *testing.T) {
+	t.Run("validate", func(t *testing.T) {
+		Wish(t, AbsPath("/").Validate(), ShouldEqual, nil)
+		Wish(t, AbsPath("/a/b").Validate(), ShouldEqual, nil)
+		Wish(t, AbsPath("").Validate(), ShouldEqual, fmt.Errorf("path must be absolute"))
+		Wish(t, AbsPath("a/b").Validate(), ShouldEqual, fmt.Errorf("path must be absolute"))
+		Wish(t, AbsPath("/a/").Validate(), ShouldEqual, fmt.Errorf(`path is not clean (should be "/a")`))
+		Wish(t, AbsPath("/a/../b").Validate(), ShouldEqual, fmt.Errorf(`path is not clean (should be "/b")`))
+	})
+	t.Run("clean and join", func(t *testing.T) {
+		Wish(t, AbsPath("/a//b/./c/").Clean(), ShouldEqual, AbsPath("/a/b/c"))
+		Wish(t, AbsPath("/a").Join("b", "c"), ShouldEqual, AbsPath("/a/b/c"))
+		Wish(t, AbsPath("/a").Join("../../.."), ShouldEqual, AbsPath("/"))
+		Wish(t, AbsPath("/").Join("x/"), ShouldEqual, AbsPath("/x"))
+	})
+	t.Run("ancestry", func(t *testing.T) {
+		Wish(t, AbsPath("/").IsAncestorOf("/a"), ShouldEqual, true)
+		Wish(t, AbsPath("/a").IsAncestorOf("/a/b/c"), ShouldEqual, true)
+		Wish(t, AbsPath("/a/").IsAncestorOf("/a/b"), ShouldEqual, true)
+		Wish(t, AbsPath("/a").IsAncestorOf("/a"), ShouldEqual, false)
+		Wish(t, AbsPath("/a").IsAncestorOf("/ab"), ShouldEqual, false)
+		Wish(t, AbsPath("/a/b").IsAncestorOf("/a"), ShouldEqual, false)
+	})
+	t.Run("rel", func(t *testing.T) {
+		rel, err := AbsPath("/a").Rel("/a/b/c")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, rel, ShouldEqual, "b/c")
+		rel, err = AbsPath("/").Rel("/a")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, rel, ShouldEqual, "a")
+		rel, err = AbsPath("/a").Rel("/a/")
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, rel, ShouldEqual, ".")
+		_, err = AbsPath("/a").Rel("/b")
+		Wish(t, err, ShouldEqual, fmt.Errorf(`path "/b" is not inside "/a"`))
+	})
+	t.Run("mount order", func(t *testing.T) {
+		paths := []AbsPath{"/a-b", "/b", "/a/c", "/a/", "/", "/a", "/a/c/d", "/a.b"}
+		SortMountOrder(paths)
+		Wish(t, paths, ShouldEqual, []AbsPath{"/", "/a", "/a/", "/a/c", "/a/c/d", "/a-b", "/a.b", "/b"})
+	})
+}
@@ -0,0 +1,189 @@
+/*
+	Package provenance produces in-toto Statements with SLSA provenance
+	predicates, describing how the outputs of a formula run were made.
+
+	Everything in the statement comes from the Formula and its
+	FormulaRunRecord: the subjects are the wares in the record's Results,
+	and the materials are the formula's Inputs.  Optionally, the Pins and
+	ImportRefs which fed the formula (e.g. from funcs.ResolvePins) can be
+	supplied, and materials which came from the catalog are then described
+	by their catalog ItemRefs, rather than just by their WareIDs.
+
+	See https://in-toto.io/Statement/v0.1 and https://slsa.dev/provenance/v0.2
+	for the formats.
+*/
+package provenance
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/funcs"
+)
+
+type ErrorCategory string
+
+const (
+	ErrInvalidRecord ErrorCategory = ("provenance-invalid-record") // Indicates the run record doesn't describe a successful run of the formula.
+)
+
+const (
+	StatementType        = "https://in-toto.io/Statement/v0.1"
+	PredicateType        = "https://slsa.dev/provenance/v0.2"
+	BuildType            = "https://github.com/polydawn/go-timeless-api/Formula@v1" // The buildConfig is an api.Formula.
+	DefaultBuilderID     = "https://github.com/polydawn/repeatr"
+	DigestAlgorithm_Ware = "wareID" // Digests are WareID strings, e.g. "tar:6q7G4hWr283FpTa5Lf8heVqw9t97b5VoMU6AGszuBYAz9EzQdeHVFAou7c4W9vFcQ6".
+)
+
+type Options struct {
+	// BuilderID identifies what ran the formula.  If empty, DefaultBuilderID is used.
+	BuilderID string
+
+	// Pins and Imports, if given, are used to say where materials came from.
+	// Imports are keyed like Pins; funcs.PinnedImports gives them in this form.
+	Pins    funcs.Pins
+	Imports map[api.SubmoduleSlotRef]api.ImportRef
+
+	// Reproducible should be set if the run is known to be reproducible
+	// (e.g. other runs were checked by memo.CompareRunRecords).
+	Reproducible bool
+}
+
+/*
+	Generate returns a provenance Statement for a run of a formula.
+
+	Subjects are named by their output path, and materials by where they came
+	from: a catalog import (e.g. "catalog:example.org/base:v1:linux-amd64"),
+	an ingest import, or, if neither is known, simply the ware
+	(e.g. "ware:tar:asdf").  Both are in mount order, and the digest
+	of each is its WareID (see DigestAlgorithm_Ware).
+
+	An error of category ErrInvalidRecord is returned if the record isn't
+	of a successful run of the formula.  (The record's FormulaID may be the
+	setup hash of either the formula or its canonical form.)
+*/
+func Generate(frm api.Formula, rr api.FormulaRunRecord, opts Options) (*Statement, error) {
+	if ok, _ := frm.MatchesSetupHash(rr.FormulaID); !ok {
+		if ok, _ := frm.Canonicalize().MatchesSetupHash(rr.FormulaID); !ok {
+			return nil, errcat.ErrorDetailed(ErrInvalidRecord,
+				fmt.Sprintf("run record %q is not of this formula", rr.Guid),
+				map[string]string{"guid": rr.Guid, "formulaID": string(rr.FormulaID)},
+			)
+		}
+	}
+	if rr.ExitCode != 0 {
+		return nil, errcat.ErrorDetailed(ErrInvalidRecord,
+			fmt.Sprintf("run record %q is not of a successful run (exit code %d)", rr.Guid, rr.ExitCode),
+			map[string]string{"guid": rr.Guid, "formulaID": string(rr.FormulaID)},
+		)
+	}
+	builderID := opts.BuilderID
+	if builderID == "" {
+		builderID = DefaultBuilderID
+	}
+
+	st := &Statement{
+		Type:          StatementType,
+		Subject:       []Subject{},
+		PredicateType: PredicateType,
+		Predicate: Provenance{
+			Builder:     Builder{ID: builderID},
+			BuildType:   BuildType,
+			BuildConfig: frm,
+			Metadata: Metadata{
+				BuildInvocationID: rr.Guid,
+				Completeness: Completeness{
+					Parameters: true,
+					Materials:  true, // formulas are hermetic: the inputs are everything.
+				},
+				Reproducible: opts.Reproducible,
+			},
+			Materials: []Material{},
+		},
+	}
+	if rr.Time != 0 {
+		st.Predicate.Metadata.BuildStartedOn = time.Unix(rr.Time, 0).UTC().Format(time.RFC3339)
+	}
+	if rr.Hostname != "" {
+		st.Predicate.Invocation = &Invocation{Environment: map[string]string{"hostname": rr.Hostname}}
+	}
+
+	// Subjects.
+	for _, path := range sortedPaths(rr.Results) {
+		st.Subject = append(st.Subject, Subject{
+			Name:   string(path),
+			Digest: DigestSet{DigestAlgorithm_Ware: rr.Results[path].String()},
+		})
+	}
+
+	// Materials.
+	origins := materialOrigins(opts.Pins, opts.Imports)
+	seen := map[string]struct{}{}
+	for _, path := range sortedPaths(frm.Inputs) {
+		wareID := frm.Inputs[path]
+		uri, ok := origins[wareID]
+		if !ok {
+			uri = "ware:" + wareID.String()
+		}
+		if _, ok := seen[uri+"\x00"+wareID.String()]; ok {
+			continue // the same ware mounted twice is still one material.
+		}
+		seen[uri+"\x00"+wareID.String()] = struct{}{}
+		st.Predicate.Materials = append(st.Predicate.Materials, Material{
+			URI:    uri,
+			Digest: DigestSet{DigestAlgorithm_Ware: wareID.String()},
+		})
+	}
+	return st, nil
+}
+
+// materialOrigins returns a description of where each pinned ware came from.
+// If a ware was pinned by more than one import, catalog imports are
+// preferred, then the first ref in sorted order.
+func materialOrigins(pins funcs.Pins, imports map[api.SubmoduleSlotRef]api.ImportRef) map[api.WareID]string {
+	refs := make([]api.SubmoduleSlotRef, 0, len(pins))
+	for ref := range pins {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+	r := map[api.WareID]string{}
+	for _, ref := range refs {
+		wareID := pins[ref]
+		switch imp := imports[ref].(type) {
+		case api.ImportRef_Catalog:
+			if existing, ok := r[wareID]; !ok || !strings.HasPrefix(existing, "catalog:") {
+				r[wareID] = imp.String()
+			}
+		case api.ImportRef_Ingest:
+			if _, ok := r[wareID]; !ok {
+				r[wareID] = imp.String()
+			}
+		}
+	}
+	return r
+}
+
+func sortedPaths(m map[api.AbsPath]api.WareID) []api.AbsPath {
+	paths := make([]api.AbsPath, 0, len(m))
+	for path := range m {
+		paths = append(paths, path)
+	}
+	api.SortMountOrder(paths)
+	return paths
+}
+
+// Marshal returns the statement as indented JSON (with sorted keys).
+func Marshal(st Statement) []byte {
+	bs, err := refmt.MarshalAtlased(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, st, Atlas)
+	if err != nil {
+		panic(err) // the atlas covers the whole type; this can't fail.
+	}
+	return bs
+}
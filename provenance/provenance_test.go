@@ -0,0 +1,174 @@
+package provenance
+
+import (
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/funcs"
+)
+
+func TestGenerate(t *testing.T) {
+	module := api.Module{
+		Imports: map[api.SlotName]api.ImportRef{
+			"base": api.ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  api.ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[api.StepName]api.StepUnion{
+			"build": api.Operation{
+				Inputs:  map[api.AbsPath]api.SlotRef{"/": {"", "base"}, "/src": {"", "src"}},
+				Action:  api.FormulaAction{Exec: []string{"make"}},
+				Outputs: map[api.SlotName]api.AbsPath{"out": "/out"},
+			},
+		},
+	}
+	pins := funcs.Pins{
+		{"", api.SlotRef{"", "base"}}: {"tar", "aaaa"},
+		{"", api.SlotRef{"", "src"}}:  {"git", "f00f"},
+	}
+	frm := api.Formula{
+		Inputs: map[api.AbsPath]api.WareID{
+			"/":      {"tar", "aaaa"},
+			"/src":   {"git", "f00f"},
+			"/extra": {"tar", "eeee"},
+		},
+		Action:  api.FormulaAction{Exec: []string{"make"}},
+		Outputs: map[api.AbsPath]api.FormulaOutputSpec{"/out": {PackType: "tar"}, "/log": {PackType: "tar"}},
+	}
+	rr := api.FormulaRunRecord{
+		Guid:      "guid-1",
+		Time:      1500000000,
+		FormulaID: frm.SetupHash(),
+		Results:   map[api.AbsPath]api.WareID{"/out": {"tar", "0u70"}, "/log": {"tar", "1091"}},
+		Hostname:  "builder-a",
+	}
+
+	t.Run("statement should describe the run", func(t *testing.T) {
+		st, err := Generate(frm, rr, Options{Pins: pins, Imports: funcs.PinnedImports(module), Reproducible: true})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, st.Type, ShouldEqual, StatementType)
+		Wish(t, st.PredicateType, ShouldEqual, PredicateType)
+		Wish(t, st.Subject, ShouldEqual, []Subject{
+			{"/log", DigestSet{"wareID": "tar:1091"}},
+			{"/out", DigestSet{"wareID": "tar:0u70"}},
+		})
+		Wish(t, st.Predicate.Materials, ShouldEqual, []Material{
+			{"catalog:example.org/base:v1:linux-amd64", DigestSet{"wareID": "tar:aaaa"}},
+			{"ware:tar:eeee", DigestSet{"wareID": "tar:eeee"}},
+			{"ingest:git:.:HEAD", DigestSet{"wareID": "git:f00f"}},
+		})
+		Wish(t, st.Predicate.Builder.ID, ShouldEqual, DefaultBuilderID)
+		Wish(t, st.Predicate.BuildConfig, ShouldEqual, frm)
+		Wish(t, st.Predicate.Invocation, ShouldEqual, &Invocation{Environment: map[string]string{"hostname": "builder-a"}})
+		Wish(t, st.Predicate.Metadata, ShouldEqual, Metadata{
+			BuildInvocationID: "guid-1",
+			BuildStartedOn:    "2017-07-14T02:40:00Z",
+			Completeness:      Completeness{Parameters: true, Materials: true},
+			Reproducible:      true,
+		})
+	})
+	t.Run("statement should serialize", func(t *testing.T) {
+		st, err := Generate(frm, rr, Options{BuilderID: "https://builder.example.org/"})
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, string(Marshal(*st)), ShouldEqual, `{
+	"_type": "https://in-toto.io/Statement/v0.1",
+	"subject": [
+		{
+			"name": "/log",
+			"digest": {
+				"wareID": "tar:1091"
+			}
+		},
+		{
+			"name": "/out",
+			"digest": {
+				"wareID": "tar:0u70"
+			}
+		}
+	],
+	"predicateType": "https://slsa.dev/provenance/v0.2",
+	"predicate": {
+		"builder": {
+			"id": "https://builder.example.org/"
+		},
+		"buildType": "https://github.com/polydawn/go-timeless-api/Formula@v1",
+		"invocation": {
+			"environment": {
+				"hostname": "builder-a"
+			}
+		},
+		"buildConfig": {
+			"inputs": {
+				"/": "tar:aaaa",
+				"/extra": "tar:eeee",
+				"/src": "git:f00f"
+			},
+			"action": {
+				"exec": [
+					"make"
+				]
+			},
+			"outputs": {
+				"/log": {
+					"packtype": "tar",
+					"filters": null
+				},
+				"/out": {
+					"packtype": "tar",
+					"filters": null
+				}
+			}
+		},
+		"metadata": {
+			"buildInvocationId": "guid-1",
+			"buildStartedOn": "2017-07-14T02:40:00Z",
+			"completeness": {
+				"parameters": true,
+				"environment": false,
+				"materials": true
+			},
+			"reproducible": false
+		},
+		"materials": [
+			{
+				"uri": "ware:tar:aaaa",
+				"digest": {
+					"wareID": "tar:aaaa"
+				}
+			},
+			{
+				"uri": "ware:tar:eeee",
+				"digest": {
+					"wareID": "tar:eeee"
+				}
+			},
+			{
+				"uri": "ware:git:f00f",
+				"digest": {
+					"wareID": "git:f00f"
+				}
+			}
+		]
+	}
+}
+`)
+	})
+	t.Run("canonical formula IDs should be accepted", func(t *testing.T) {
+		rr2 := rr
+		rr2.FormulaID = frm.CanonicalSetupHash()
+		_, err := Generate(frm, rr2, Options{})
+		Wish(t, err, ShouldEqual, nil)
+	})
+	t.Run("mismatched records should be rejected", func(t *testing.T) {
+		rr2 := rr
+		rr2.FormulaID = api.Formula{}.SetupHash()
+		_, err := Generate(frm, rr2, Options{})
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidRecord)
+		rr2 = rr
+		rr2.ExitCode = 2
+		_, err = Generate(frm, rr2, Options{})
+		Wish(t, errcat.Category(err), ShouldEqual, ErrInvalidRecord)
+	})
+}
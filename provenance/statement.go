@@ -0,0 +1,57 @@
+package provenance
+
+import (
+	api "github.com/polydawn/go-timeless-api"
+)
+
+// Statement is an in-toto Statement, with a SLSA provenance predicate.
+type Statement struct {
+	Type          string     `refmt:"_type"`
+	Subject       []Subject  `refmt:"subject"`
+	PredicateType string     `refmt:"predicateType"`
+	Predicate     Provenance `refmt:"predicate"`
+}
+
+type Subject struct {
+	Name   string    `refmt:"name"`
+	Digest DigestSet `refmt:"digest"`
+}
+
+// DigestSet maps digest algorithm names to digests.
+// Ours only ever contain DigestAlgorithm_Ware.
+type DigestSet map[string]string
+
+type Provenance struct {
+	Builder     Builder     `refmt:"builder"`
+	BuildType   string      `refmt:"buildType"`
+	Invocation  *Invocation `refmt:"invocation,omitempty"`
+	BuildConfig api.Formula `refmt:"buildConfig"`
+	Metadata    Metadata    `refmt:"metadata"`
+	Materials   []Material  `refmt:"materials"`
+}
+
+type Builder struct {
+	ID string `refmt:"id"`
+}
+
+type Invocation struct {
+	Environment map[string]string `refmt:"environment,omitempty"`
+}
+
+type Metadata struct {
+	BuildInvocationID string       `refmt:"buildInvocationId"`
+	BuildStartedOn    string       `refmt:"buildStartedOn,omitempty"` // RFC 3339.
+	Completeness      Completeness `refmt:"completeness"`
+	Reproducible      bool         `refmt:"reproducible"`
+}
+
+type Completeness struct {
+	Parameters  bool `refmt:"parameters"`
+	Environment bool `refmt:"environment"`
+	Materials   bool `refmt:"materials"`
+}
+
+type Material struct {
+	URI    string    `refmt:"uri"`
+	Digest DigestSet `refmt:"digest"`
+}
@@ -0,0 +1,35 @@
+package provenance
+
+import (
+	"github.com/polydawn/refmt/obj/atlas"
+
+	api "github.com/polydawn/go-timeless-api"
+)
+
+var Atlas = atlas.MustBuild(
+	Statement_AtlasEntry,
+	Subject_AtlasEntry,
+	Provenance_AtlasEntry,
+	Builder_AtlasEntry,
+	Invocation_AtlasEntry,
+	Metadata_AtlasEntry,
+	Completeness_AtlasEntry,
+	Material_AtlasEntry,
+	api.Formula_AtlasEntry,
+	api.FormulaAction_AtlasEntry,
+	api.FormulaUserinfo_AtlasEntry,
+	api.FormulaOutputSpec_AtlasEntry,
+	api.FilesetPackFilter_AtlasEntry,
+	api.WareID_AtlasEntry,
+)
+
+var (
+	Statement_AtlasEntry    = atlas.BuildEntry(Statement{}).StructMap().Autogenerate().Complete()
+	Subject_AtlasEntry      = atlas.BuildEntry(Subject{}).StructMap().Autogenerate().Complete()
+	Provenance_AtlasEntry   = atlas.BuildEntry(Provenance{}).StructMap().Autogenerate().Complete()
+	Builder_AtlasEntry      = atlas.BuildEntry(Builder{}).StructMap().Autogenerate().Complete()
+	Invocation_AtlasEntry   = atlas.BuildEntry(Invocation{}).StructMap().Autogenerate().Complete()
+	Metadata_AtlasEntry     = atlas.BuildEntry(Metadata{}).StructMap().Autogenerate().Complete()
+	Completeness_AtlasEntry = atlas.BuildEntry(Completeness{}).StructMap().Autogenerate().Complete()
+	Material_AtlasEntry     = atlas.BuildEntry(Material{}).StructMap().Autogenerate().Complete()
+)
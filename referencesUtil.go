@@ -24,6 +24,27 @@ func (ref SubmoduleRef) Child(child StepName) SubmoduleRef {
 	return SubmoduleRef(string(ref) + "." + string(child))
 }
 
+// Last returns the last StepName component of the SubmoduleRef.
+// The empty string is returned if this SubmoduleRef is itself zero.
+func (ref SubmoduleRef) Last() StepName {
+	i := strings.LastIndexByte(string(ref), '.')
+	if i >= 0 {
+		return StepName(ref[i+1:])
+	}
+	return StepName(ref)
+}
+
+// Parent strips the last stepName from the end of the ref.
+// Think of it as zooming out by one level
+// ('Child' and 'Parent' are opposites.)
+func (ref SubmoduleRef) Parent() SubmoduleRef {
+	i := strings.LastIndexByte(string(ref), '.')
+	if i > 0 {
+		return ref[:i]
+	}
+	return ""
+}
+
 // Contextualize prepends a set of step references to this ref.
 // Think of it as zooming out.
 func (ref SubmoduleRef) Contextualize(parent SubmoduleRef) SubmoduleRef {
@@ -1 +1,38 @@
 package api
+
+import (
+	"regexp"
+)
+
+// Validate returns errors if the string is not a valid StepName.
+// StepNames must be nonempty, and may contain alphanumerics, '-', and '_'.
+// (In particular, they may not contain '.' or ':', since those are
+// separators in the string forms of SlotRef and ImportRef.)
+func (x StepName) Validate() error {
+	return validateLocalName("stepName", string(x))
+}
+
+// Validate returns errors if the string is not a valid SlotName.
+// The rules are the same as for StepName.
+func (x SlotName) Validate() error {
+	return validateLocalName("slotName", string(x))
+}
+
+const validation_localName_regexpStr string = "[a-zA-Z0-9_][-_a-zA-Z0-9]*"
+const validation_localName_msg string = "must consist of alphanumeric characters, '-', or '_', and must not start with '-'"
+const validation_localName_maxlen int = 63
+
+var validation_localName_regexp = regexp.MustCompile("^" + validation_localName_regexpStr + "$")
+
+func validateLocalName(use string, value string) error {
+	if len(value) == 0 {
+		return fmtEmptyError(use)
+	}
+	if len(value) > validation_localName_maxlen {
+		return fmtMaxLenError(use, validation_localName_maxlen)
+	}
+	if !validation_localName_regexp.MatchString(value) {
+		return fmtMatchError(use, validation_localName_msg)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package sbom
+
+// BOM is a CycloneDX bill of materials.  Only the parts of the format
+// which we fill in are described here.
+type BOM struct {
+	BOMFormat   string      `refmt:"bomFormat"`
+	SpecVersion string      `refmt:"specVersion"`
+	Version     int         `refmt:"version"`
+	Components  []Component `refmt:"components"`
+}
+
+type Component struct {
+	Type       string          `refmt:"type"`
+	BOMRef     string          `refmt:"bom-ref"`
+	Group      string          `refmt:"group,omitempty"`
+	Name       string          `refmt:"name"`
+	Version    string          `refmt:"version,omitempty"`
+	Licenses   []LicenseChoice `refmt:"licenses,omitempty"`
+	Properties []Property      `refmt:"properties,omitempty"`
+}
+
+// LicenseChoice holds an SPDX license expression (which may be as simple
+// as a single license ID, e.g. "Apache-2.0").
+type LicenseChoice struct {
+	Expression string `refmt:"expression"`
+}
+
+type Property struct {
+	Name  string `refmt:"name"`
+	Value string `refmt:"value"`
+}
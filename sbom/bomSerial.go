@@ -0,0 +1,19 @@
+package sbom
+
+import (
+	"github.com/polydawn/refmt/obj/atlas"
+)
+
+var Atlas = atlas.MustBuild(
+	BOM_AtlasEntry,
+	Component_AtlasEntry,
+	LicenseChoice_AtlasEntry,
+	Property_AtlasEntry,
+)
+
+var (
+	BOM_AtlasEntry           = atlas.BuildEntry(BOM{}).StructMap().Autogenerate().Complete()
+	Component_AtlasEntry     = atlas.BuildEntry(Component{}).StructMap().Autogenerate().Complete()
+	LicenseChoice_AtlasEntry = atlas.BuildEntry(LicenseChoice{}).StructMap().Autogenerate().Complete()
+	Property_AtlasEntry      = atlas.BuildEntry(Property{}).StructMap().Autogenerate().Complete()
+)
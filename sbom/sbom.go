@@ -0,0 +1,206 @@
+/*
+	Package sbom produces CycloneDX bills of materials for modules.
+
+	A module's materials are its imports: every catalog import (recursively,
+	through submodules) is listed with its ItemRef, the WareID it was pinned
+	to, and whatever license and version information the catalog's Release
+	metadata has for it.  Ingest imports are listed too, but since they come
+	straight from wherever the ingest pointed rather than from an audited
+	release, they're flagged as un-audited.
+
+	See https://cyclonedx.org/docs/1.4/json/ for the format.
+*/
+package sbom
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/polydawn/refmt"
+	"github.com/polydawn/refmt/json"
+	"github.com/warpfork/go-errcat"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/funcs"
+	"github.com/polydawn/go-timeless-api/hitch"
+)
+
+type ErrorCategory string
+
+const (
+	ErrMissingPin  ErrorCategory = ("sbom-missing-pin")  // Indicates an import of the module has no pin, so we can't say what ware it is.
+	ErrPinMismatch ErrorCategory = ("sbom-pin-mismatch") // Indicates a catalog import's pin isn't the ware the catalog has for it, so the release's metadata doesn't describe it.
+)
+
+const (
+	BOMFormat   = "CycloneDX"
+	SpecVersion = "1.4"
+)
+
+// Release metadata keys which are given special treatment.
+// Other metadata is listed as properties named "timeless:metadata:{key}".
+const (
+	MetadataKey_License = "license" // An SPDX license expression.
+	MetadataKey_Version = "version" // Used for the component's version instead of the release name.
+)
+
+// Property names used on components.
+const (
+	Property_WareID  = "timeless:wareID"
+	Property_Import  = "timeless:import"  // One for each import of the component, e.g. "base" or "stepB.base".
+	Property_Audited = "timeless:audited" // "false" for ingest imports.
+	Property_Hazard  = "timeless:hazard:" // Prefix; one for each of the release's Hazards.
+	Property_Meta    = "timeless:metadata:"
+)
+
+/*
+	Generate returns a bill of materials for the module.
+
+	Pins are as returned by funcs.ResolvePins (or ResolvePinsFromLockfile);
+	every catalog and ingest import must have one, or an error of category
+	ErrMissingPin is returned.  The lineage of each module imported from is
+	fetched once with viewLineageTool, and errors from it (or from looking up
+	the release, which are of hitch.LookupError categories) are returned as-is.
+	The pin of every catalog import must be the ware the release has for that
+	item, or an error of category ErrPinMismatch is returned (so stale or
+	edited pins are never described by some other ware's license and version).
+
+	Components are sorted by their bom-ref, and a ware imported more than
+	once appears once, with all its imports listed.
+*/
+func Generate(
+	ctx context.Context,
+	m api.Module,
+	pins funcs.Pins,
+	viewLineageTool hitch.ViewLineageTool,
+) (*BOM, error) {
+	imports := funcs.PinnedImports(m)
+	refs := make([]api.SubmoduleSlotRef, 0, len(imports))
+	for ref := range imports {
+		refs = append(refs, ref)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].String() < refs[j].String() })
+
+	lineages := map[api.ModuleName]*api.Lineage{}
+	components := map[string]*Component{}
+	for _, ref := range refs {
+		wareID, ok := pins[ref]
+		if !ok {
+			return nil, errcat.ErrorDetailed(ErrMissingPin,
+				fmt.Sprintf("import %q has no pin", ref),
+				map[string]string{"ref": ref.String()},
+			)
+		}
+		var bomRef string
+		switch imp := imports[ref].(type) {
+		case api.ImportRef_Catalog:
+			bomRef = imp.String()
+			lin, ok := lineages[imp.ModuleName]
+			if !ok {
+				var err error
+				lin, err = viewLineageTool(ctx, imp.ModuleName)
+				if err != nil {
+					return nil, err
+				}
+				lineages[imp.ModuleName] = lin
+			}
+			released, err := hitch.LineagePluckReleaseItem(*lin, imp.ReleaseName, imp.ItemName)
+			if err != nil {
+				return nil, err
+			}
+			if *released != wareID {
+				return nil, errcat.ErrorDetailed(ErrPinMismatch,
+					fmt.Sprintf("import %q is pinned to %q, but %q is %q", ref, wareID, imp, *released),
+					map[string]string{"ref": ref.String()},
+				)
+			}
+			if components[bomRef] != nil {
+				break
+			}
+			rel, err := hitch.LineagePluckReleaseByName(*lin, imp.ReleaseName)
+			if err != nil {
+				return nil, err
+			}
+			components[bomRef] = catalogComponent(bomRef, api.ItemRef(imp), wareID, *rel)
+		case api.ImportRef_Ingest:
+			bomRef = imp.String() + "@" + wareID.String()
+			if components[bomRef] != nil {
+				break
+			}
+			components[bomRef] = &Component{
+				Type:   "library",
+				BOMRef: bomRef,
+				Name:   imp.String(),
+				Properties: []Property{
+					{Property_WareID, wareID.String()},
+					{Property_Audited, "false"},
+				},
+			}
+		}
+		components[bomRef].Properties = append(components[bomRef].Properties, Property{Property_Import, ref.String()})
+	}
+
+	bom := &BOM{
+		BOMFormat:   BOMFormat,
+		SpecVersion: SpecVersion,
+		Version:     1,
+		Components:  make([]Component, 0, len(components)),
+	}
+	bomRefs := make([]string, 0, len(components))
+	for bomRef := range components {
+		bomRefs = append(bomRefs, bomRef)
+	}
+	sort.Strings(bomRefs)
+	for _, bomRef := range bomRefs {
+		bom.Components = append(bom.Components, *components[bomRef])
+	}
+	return bom, nil
+}
+
+func catalogComponent(bomRef string, item api.ItemRef, wareID api.WareID, rel api.Release) *Component {
+	c := &Component{
+		Type:    "library",
+		BOMRef:  bomRef,
+		Group:   string(item.ModuleName),
+		Name:    string(item.ItemName),
+		Version: string(item.ReleaseName),
+		Properties: []Property{
+			{Property_WareID, wareID.String()},
+		},
+	}
+	if v, ok := rel.Metadata[MetadataKey_Version]; ok {
+		c.Version = v
+	}
+	if v, ok := rel.Metadata[MetadataKey_License]; ok {
+		c.Licenses = []LicenseChoice{{v}}
+	}
+	for _, k := range sortedKeys(rel.Hazards) {
+		c.Properties = append(c.Properties, Property{Property_Hazard + k, rel.Hazards[k]})
+	}
+	for _, k := range sortedKeys(rel.Metadata) {
+		if k == MetadataKey_Version || k == MetadataKey_License {
+			continue
+		}
+		c.Properties = append(c.Properties, Property{Property_Meta + k, rel.Metadata[k]})
+	}
+	return c
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Marshal returns the bill of materials as indented JSON.
+func Marshal(bom BOM) []byte {
+	bs, err := refmt.MarshalAtlased(json.EncodeOptions{Line: []byte{'\n'}, Indent: []byte{'\t'}}, bom, Atlas)
+	if err != nil {
+		panic(err) // the atlas covers the whole type; this can't fail.
+	}
+	return bs
+}
@@ -0,0 +1,165 @@
+package sbom
+
+import (
+	"context"
+	"testing"
+
+	"github.com/warpfork/go-errcat"
+	. "github.com/warpfork/go-wish"
+
+	api "github.com/polydawn/go-timeless-api"
+	"github.com/polydawn/go-timeless-api/funcs"
+	"github.com/polydawn/go-timeless-api/hitch"
+	mockhitch "github.com/polydawn/go-timeless-api/hitch/mock"
+)
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	module := api.Module{
+		Imports: map[api.SlotName]api.ImportRef{
+			"base": api.ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+			"src":  api.ImportRef_Ingest{"git", ".:HEAD"},
+		},
+		Steps: map[api.StepName]api.StepUnion{
+			"sub": api.Module{
+				Imports: map[api.SlotName]api.ImportRef{
+					"base": api.ImportRef_Catalog{"example.org/base", "v1", "linux-amd64"},
+					"tool": api.ImportRef_Catalog{"example.org/tool", "v2.1", "bin"},
+					"src":  api.ImportRef_Parent{"", "src"},
+				},
+			},
+		},
+	}
+	pins := funcs.Pins{
+		{"", api.SlotRef{"", "base"}}:    {"tar", "aaaa"},
+		{"", api.SlotRef{"", "src"}}:     {"git", "f00f"},
+		{"sub", api.SlotRef{"", "base"}}: {"tar", "aaaa"},
+		{"sub", api.SlotRef{"", "tool"}}: {"tar", "7007"},
+	}
+	calls := 0
+	fixture := mockhitch.Fixture{map[api.ModuleName]api.Lineage{
+		"example.org/base": {"example.org/base", []api.Release{
+			{Name: "v1",
+				Items:    map[api.ItemName]api.WareID{"linux-amd64": {"tar", "aaaa"}},
+				Metadata: map[string]string{"license": "MIT OR Apache-2.0", "version": "1.0.0", "homepage": "https://example.org/"},
+				Hazards:  map[string]string{"cve": "CVE-2018-0001"},
+			},
+		}},
+		"example.org/tool": {"example.org/tool", []api.Release{
+			{Name: "v2.1", Items: map[api.ItemName]api.WareID{"bin": {"tar", "7007"}}},
+		}},
+	}}
+	viewLineage := func(ctx context.Context, modName api.ModuleName) (*api.Lineage, error) {
+		calls++
+		return fixture.ViewLineage(ctx, modName)
+	}
+
+	t.Run("all imports should be listed", func(t *testing.T) {
+		bom, err := Generate(ctx, module, pins, viewLineage)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, calls, ShouldEqual, 2)
+		Wish(t, bom, ShouldEqual, &BOM{
+			BOMFormat:   "CycloneDX",
+			SpecVersion: "1.4",
+			Version:     1,
+			Components: []Component{
+				{
+					Type:     "library",
+					BOMRef:   "catalog:example.org/base:v1:linux-amd64",
+					Group:    "example.org/base",
+					Name:     "linux-amd64",
+					Version:  "1.0.0",
+					Licenses: []LicenseChoice{{"MIT OR Apache-2.0"}},
+					Properties: []Property{
+						{"timeless:wareID", "tar:aaaa"},
+						{"timeless:hazard:cve", "CVE-2018-0001"},
+						{"timeless:metadata:homepage", "https://example.org/"},
+						{"timeless:import", "base"},
+						{"timeless:import", "sub.base"},
+					},
+				},
+				{
+					Type:    "library",
+					BOMRef:  "catalog:example.org/tool:v2.1:bin",
+					Group:   "example.org/tool",
+					Name:    "bin",
+					Version: "v2.1",
+					Properties: []Property{
+						{"timeless:wareID", "tar:7007"},
+						{"timeless:import", "sub.tool"},
+					},
+				},
+				{
+					Type:   "library",
+					BOMRef: "ingest:git:.:HEAD@git:f00f",
+					Name:   "ingest:git:.:HEAD",
+					Properties: []Property{
+						{"timeless:wareID", "git:f00f"},
+						{"timeless:audited", "false"},
+						{"timeless:import", "src"},
+					},
+				},
+			},
+		})
+	})
+	t.Run("bom should serialize", func(t *testing.T) {
+		bom, err := Generate(ctx, api.Module{
+			Imports: map[api.SlotName]api.ImportRef{
+				"tool": api.ImportRef_Catalog{"example.org/tool", "v2.1", "bin"},
+			},
+		}, funcs.Pins{{"", api.SlotRef{"", "tool"}}: {"tar", "7007"}}, fixture.ViewLineage)
+		Wish(t, err, ShouldEqual, nil)
+		Wish(t, string(Marshal(*bom)), ShouldEqual, `{
+	"bomFormat": "CycloneDX",
+	"specVersion": "1.4",
+	"version": 1,
+	"components": [
+		{
+			"type": "library",
+			"bom-ref": "catalog:example.org/tool:v2.1:bin",
+			"group": "example.org/tool",
+			"name": "bin",
+			"version": "v2.1",
+			"properties": [
+				{
+					"name": "timeless:wareID",
+					"value": "tar:7007"
+				},
+				{
+					"name": "timeless:import",
+					"value": "tool"
+				}
+			]
+		}
+	]
+}
+`)
+	})
+	t.Run("missing pins should be reported", func(t *testing.T) {
+		_, err := Generate(ctx, module, funcs.Pins{}, fixture.ViewLineage)
+		Wish(t, errcat.Category(err), ShouldEqual, ErrMissingPin)
+	})
+	t.Run("pins diverging from the catalog should be reported", func(t *testing.T) {
+		for _, diverging := range []api.SubmoduleSlotRef{
+			{"", api.SlotRef{"", "base"}},
+			{"sub", api.SlotRef{"", "base"}},
+		} {
+			pins2 := funcs.Pins{}
+			for ref, wareID := range pins {
+				pins2[ref] = wareID
+			}
+			pins2[diverging] = api.WareID{"tar", "bbbb"}
+			_, err := Generate(ctx, module, pins2, fixture.ViewLineage)
+			Wish(t, errcat.Category(err), ShouldEqual, ErrPinMismatch)
+			Wish(t, errcat.Details(err), ShouldEqual, map[string]string{"ref": diverging.String()})
+		}
+	})
+	t.Run("missing releases should be reported", func(t *testing.T) {
+		_, err := Generate(ctx, api.Module{
+			Imports: map[api.SlotName]api.ImportRef{
+				"tool": api.ImportRef_Catalog{"example.org/tool", "v9", "bin"},
+			},
+		}, funcs.Pins{{"", api.SlotRef{"", "tool"}}: {"tar", "7007"}}, fixture.ViewLineage)
+		Wish(t, errcat.Category(err), ShouldEqual, hitch.ErrNoSuchRelease)
+	})
+}